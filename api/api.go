@@ -1,6 +1,10 @@
 package api
 
+import (
+	"github.com/wcgcyx/ethgen/tracker"
+)
+
 type API struct {
 	Upcheck  func() bool
-	Generate func(number uint, tokenWeight uint, txWeight uint) ([]string, error)
+	Generate func(number uint, weights map[string]uint, opts tracker.GenerateOptions) ([]tracker.Query, error)
 }
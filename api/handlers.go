@@ -2,6 +2,7 @@ package api
 
 import (
 	"github.com/wcgcyx/ethgen/node"
+	"github.com/wcgcyx/ethgen/tracker"
 )
 
 type apiHandler struct {
@@ -12,6 +13,6 @@ func (h *apiHandler) Upcheck() bool {
 	return h.node.OK()
 }
 
-func (h *apiHandler) Generate(number uint, tokenWeight uint, txWeight uint) ([]string, error) {
-	return h.node.GenerateQuery(number, tokenWeight, txWeight)
+func (h *apiHandler) Generate(number uint, weights map[string]uint, opts tracker.GenerateOptions) ([]tracker.Query, error) {
+	return h.node.GenerateQuery(number, weights, opts)
 }
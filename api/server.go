@@ -10,7 +10,7 @@ import (
 )
 
 type Server struct {
-	s http.Server
+	s *http.Server
 }
 
 func NewServer(node *node.Node, port int) (*Server, error) {
@@ -19,7 +19,7 @@ func NewServer(node *node.Node, port int) (*Server, error) {
 		node: node,
 	}
 	rpc.Register("ethgen", &apiHandler)
-	s := http.Server{
+	s := &http.Server{
 		Addr:           fmt.Sprintf("localhost:%v", port),
 		Handler:        rpc,
 		ReadTimeout:    60 * time.Second,
@@ -0,0 +1,124 @@
+package bench
+
+import (
+	"fmt"
+	"testing"
+
+	tk "github.com/wcgcyx/ethgen/tracker"
+)
+
+const (
+	// Transactions per block, blocks generated and window of trackers
+	benchTxs    = 200
+	benchBlocks = 16
+	benchWindow = 100
+	// Queries generated per call in generation benchmarks
+	generateBatch = 1000
+)
+
+var (
+	// Configured contracts of ingestion benchmarks
+	ingestContracts = []uint{10, 100, 500}
+	// Synthetic chains by configured contracts, shared by benchmarks
+	chains = make(map[uint]*chain)
+	// Trackers of generation benchmarks by name
+	generators map[string]tk.Tracker
+)
+
+// benchChain gets the synthetic chain with the given configured contracts.
+func benchChain(b *testing.B, contracts uint) *chain {
+	if c, ok := chains[contracts]; ok {
+		return c
+	}
+	c, err := newChain(chainConfig{
+		Contracts: contracts,
+		Txs:       benchTxs,
+		Blocks:    benchBlocks,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	chains[contracts] = c
+	return c
+}
+
+// BenchmarkDecode benchmarks decoding blocks, recovering every sender.
+func BenchmarkDecode(b *testing.B) {
+	c := benchChain(b, ingestContracts[0])
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tk.NewBlock(c.blocks[i%len(c.blocks)], c.signer)
+	}
+}
+
+// BenchmarkIngest benchmarks decoding blocks and applying them to the token,
+// transaction and account trackers, reporting the memory held by their state.
+func BenchmarkIngest(b *testing.B) {
+	for _, contracts := range ingestContracts {
+		b.Run(fmt.Sprintf("contracts=%v", contracts), func(b *testing.B) {
+			c := benchChain(b, contracts)
+			trackers := c.ingestTrackers(benchWindow, 0)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				blk := tk.NewBlock(c.blocks[i%len(c.blocks)], c.signer)
+				// Blocks are reused, numbered in order so windows slide
+				blk.Number = uint64(i)
+				for _, tracker := range trackers {
+					err := tracker.ApplyBlock(blk)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.StopTimer()
+			memory := uint64(0)
+			for _, tracker := range trackers {
+				memory += tracker.Memory()
+			}
+			b.ReportMetric(float64(memory), "state-B")
+		})
+	}
+}
+
+// benchmarkGenerate benchmarks generating queries from a tracker, in
+// batches, an op being a query.
+func benchmarkGenerate(b *testing.B, name string) {
+	if generators == nil {
+		var err error
+		generators, err = benchChain(b, ingestContracts[0]).generateTrackers(benchWindow, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	tracker := generators[name]
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += generateBatch {
+		number := generateBatch
+		if b.N-i < number {
+			number = b.N - i
+		}
+		_, err := tracker.GenerateQuery(uint(number), tk.GenerateOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerateERC20Balance(b *testing.B)   { benchmarkGenerate(b, "erc20_balance") }
+func BenchmarkGenerateERC20Approval(b *testing.B)  { benchmarkGenerate(b, "erc20_approval") }
+func BenchmarkGenerateERC721Owner(b *testing.B)    { benchmarkGenerate(b, "erc721_owner") }
+func BenchmarkGenerateERC721Approval(b *testing.B) { benchmarkGenerate(b, "erc721_approval") }
+func BenchmarkGenerateAccountBalance(b *testing.B) { benchmarkGenerate(b, "account_balance") }
+func BenchmarkGenerateAccountNonce(b *testing.B)   { benchmarkGenerate(b, "account_nonce") }
+func BenchmarkGenerateTransaction(b *testing.B)    { benchmarkGenerate(b, "transaction") }
+func BenchmarkGenerateLookup(b *testing.B)         { benchmarkGenerate(b, "lookup") }
+func BenchmarkGenerateTrace(b *testing.B)          { benchmarkGenerate(b, "trace") }
+func BenchmarkGenerateBlock(b *testing.B)          { benchmarkGenerate(b, "block") }
+func BenchmarkGenerateLogs(b *testing.B)           { benchmarkGenerate(b, "logs") }
+func BenchmarkGenerateStorage(b *testing.B)        { benchmarkGenerate(b, "storage") }
+func BenchmarkGenerateFee(b *testing.B)            { benchmarkGenerate(b, "fee") }
+func BenchmarkGenerateCode(b *testing.B)           { benchmarkGenerate(b, "code") }
+func BenchmarkGenerateMempool(b *testing.B)        { benchmarkGenerate(b, "mempool") }
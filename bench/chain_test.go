@@ -0,0 +1,168 @@
+// Package bench benchmarks block ingestion and query generation on a
+// synthetic chain, so the daemon can be profiled without an endpoint, by
+// go test -bench.
+package bench
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// chainConfig is the configuration of a synthetic chain.
+type chainConfig struct {
+	// Number of configured ERC20 and ERC721 contracts each
+	Contracts uint
+	// Transactions per block
+	Txs uint
+	// Blocks generated, applied in turn
+	Blocks uint
+}
+
+// chain is a synthetic chain of token transfers and approvals, with a share
+// of native transfers.
+type chain struct {
+	signer types.Signer
+	erc20  []string
+	erc721 []string
+	blocks []*types.Block
+	// Transfer events emitted by block number
+	logs map[uint64][]types.Log
+}
+
+var (
+	// Signature of the ERC20 and ERC721 Transfer event
+	transferEvent = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+)
+
+// Kinds of the transactions seeding every block, calling the first contracts
+const (
+	erc20Transfer = iota
+	erc20Approve
+	erc721Transfer
+	erc721Approve
+	nativeTransfer
+)
+
+// newChain generates a synthetic chain, where every transaction calls one of
+// the configured contracts except one in ten native transfers. Every block
+// starts with one transaction of each kind calling the first contracts, so
+// every query path of their trackers has data.
+func newChain(cfg chainConfig) (*chain, error) {
+	rnd := rand.New(rand.NewSource(1))
+	signer := types.LatestSignerForChainID(big.NewInt(1))
+	keys := make([]*ecdsa.PrivateKey, 64)
+	for i := range keys {
+		key, err := crypto.ToECDSA(crypto.Keccak256([]byte(fmt.Sprintf("sender%v", i))))
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	res := &chain{
+		signer: signer,
+		erc20:  make([]string, cfg.Contracts),
+		erc721: make([]string, cfg.Contracts),
+		blocks: make([]*types.Block, cfg.Blocks),
+		logs:   make(map[uint64][]types.Log),
+	}
+	for i := uint(0); i < cfg.Contracts; i++ {
+		res.erc20[i] = common.BytesToAddress(crypto.Keccak256([]byte(fmt.Sprintf("erc20%v", i)))).Hex()[2:]
+		res.erc721[i] = common.BytesToAddress(crypto.Keccak256([]byte(fmt.Sprintf("erc721%v", i)))).Hex()[2:]
+	}
+	nonce := uint64(0)
+	for i := range res.blocks {
+		number := uint64(1000000 + i)
+		txs := make([]*types.Transaction, cfg.Txs)
+		logs := make([]types.Log, 0)
+		for j := range txs {
+			key := keys[rnd.Intn(len(keys))]
+			sender := crypto.PubkeyToAddress(key.PublicKey)
+			recipient := common.BytesToAddress(crypto.Keccak256([]byte(fmt.Sprintf("recipient%v", rnd.Intn(10000)))))
+			padded := common.LeftPadBytes(recipient.Bytes(), 32)
+			var to common.Address
+			var data []byte
+			var value *big.Int
+			var accessList types.AccessList
+			kind := []int{erc20Transfer, erc20Transfer, erc20Transfer, erc20Transfer, erc20Approve, erc721Transfer, erc721Transfer, erc721Transfer, erc721Approve, nativeTransfer}[rnd.Intn(10)]
+			contract := rnd.Intn(int(cfg.Contracts))
+			if j <= nativeTransfer {
+				kind = j
+				contract = 0
+			}
+			switch kind {
+			case erc20Transfer:
+				// ERC20 transfer, touching the balance slots
+				to = common.HexToAddress(res.erc20[contract])
+				data = append(common.FromHex("a9059cbb"), padded...)
+				data = append(data, common.LeftPadBytes(big.NewInt(rnd.Int63()).Bytes(), 32)...)
+				accessList = types.AccessList{{
+					Address: to,
+					StorageKeys: []common.Hash{
+						crypto.Keccak256Hash(common.LeftPadBytes(sender.Bytes(), 32), common.Hash{}.Bytes()),
+						crypto.Keccak256Hash(padded, common.Hash{}.Bytes()),
+					},
+				}}
+				logs = append(logs, transferLog(to, sender, recipient, number))
+			case erc20Approve:
+				// ERC20 approve
+				to = common.HexToAddress(res.erc20[contract])
+				data = append(common.FromHex("095ea7b3"), padded...)
+				data = append(data, common.LeftPadBytes(big.NewInt(rnd.Int63()).Bytes(), 32)...)
+			case erc721Transfer:
+				// ERC721 transferFrom
+				to = common.HexToAddress(res.erc721[contract])
+				data = append(common.FromHex("23b872dd"), padded...)
+				data = append(data, padded...)
+				data = append(data, common.LeftPadBytes(big.NewInt(int64(rnd.Intn(10000))).Bytes(), 32)...)
+				logs = append(logs, transferLog(to, recipient, recipient, number))
+			case erc721Approve:
+				// ERC721 setApprovalForAll
+				to = common.HexToAddress(res.erc721[contract])
+				data = append(common.FromHex("a22cb465"), padded...)
+				data = append(data, common.LeftPadBytes([]byte{1}, 32)...)
+			default:
+				// Native transfer
+				to = recipient
+				value = big.NewInt(rnd.Int63())
+			}
+			tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+				ChainID:    big.NewInt(1),
+				Nonce:      nonce,
+				GasTipCap:  big.NewInt(2e9),
+				GasFeeCap:  big.NewInt(50e9),
+				Gas:        100000,
+				To:         &to,
+				Value:      value,
+				Data:       data,
+				AccessList: accessList,
+			})
+			if err != nil {
+				return nil, err
+			}
+			nonce++
+			txs[j] = tx
+		}
+		header := &types.Header{
+			Number:     new(big.Int).SetUint64(number),
+			ParentHash: crypto.Keccak256Hash([]byte(fmt.Sprintf("block%v", i))),
+		}
+		res.blocks[i] = types.NewBlockWithHeader(header).WithBody(txs, nil)
+		res.logs[number] = logs
+	}
+	return res, nil
+}
+
+// transferLog gets the Transfer event of a token.
+func transferLog(token common.Address, from common.Address, to common.Address, number uint64) types.Log {
+	return types.Log{
+		Address:     token,
+		Topics:      []common.Hash{transferEvent, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())},
+		BlockNumber: number,
+	}
+}
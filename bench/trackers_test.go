@@ -0,0 +1,99 @@
+package bench
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/wcgcyx/ethgen/idgen"
+	tk "github.com/wcgcyx/ethgen/tracker"
+)
+
+// ingestTrackers creates the trackers ingesting every transaction.
+func (c *chain) ingestTrackers(window uint, maxEntries uint) []tk.Tracker {
+	idGen := idgen.NewIdGenerator()
+	return []tk.Tracker{
+		tk.NewBatchTracker([]tk.Tracker{
+			tk.NewERC20BatchTracker(idGen, c.erc20, window, maxEntries, nil, nil),
+			tk.NewERC721BatchTracker(idGen, c.erc721, window, maxEntries, nil),
+		}),
+		tk.NewTransactionTracker(idGen, 3, tk.TransactionConfig{}),
+		tk.NewAccountBatchTracker(idGen, window, maxEntries),
+		tk.NewCodeTracker(idGen, window, maxEntries),
+	}
+}
+
+// generateTrackers creates every tracker with all methods enabled, the token
+// trackers following the first contracts which every block calls, and
+// applies the chain to them.
+func (c *chain) generateTrackers(window uint, maxEntries uint) (map[string]tk.Tracker, error) {
+	idGen := idgen.NewIdGenerator()
+	fetcher := func(number uint64) ([]types.Log, error) {
+		return c.logs[number], nil
+	}
+	txTracker := tk.NewTransactionTracker(idGen, 3, tk.TransactionConfig{Methods: all(tk.TransactionMethods)})
+	blockTracker := tk.NewBlockTracker(idGen, window, all(tk.BlockMethods), 1)
+	mempoolTracker := tk.NewMempoolTracker(idGen, c.signer, 10000, all(tk.MempoolMethods), nil)
+	erc20 := tk.NewERC20ContractTracker(idGen, tk.NewHead(), c.erc20[0], window, maxEntries, nil, nil)
+	erc721 := tk.NewERC721ContractTracker(idGen, tk.NewHead(), c.erc721[0], window, maxEntries, nil)
+	account := tk.NewAccountBatchTracker(idGen, window, maxEntries)
+	trackers := map[string]tk.Tracker{
+		"erc20_balance":   erc20.Bal(),
+		"erc20_approval":  erc20.Apv(),
+		"erc721_owner":    erc721.Own(),
+		"erc721_approval": erc721.Apv(),
+		"account_balance": account.Trackers()[0],
+		"account_nonce":   account.Trackers()[1],
+		"transaction":     txTracker,
+		"lookup":          tk.NewTransactionLookupTracker(idGen, txTracker, all(tk.TransactionLookupMethods)),
+		"trace":           tk.NewTraceTracker(idGen, txTracker, blockTracker, tk.TraceConfig{Methods: all(tk.TraceMethods), Tracers: all(tk.TraceTracers)}),
+		"block":           blockTracker,
+		"logs": tk.NewLogsTracker(idGen, fetcher, window, maxEntries, tk.LogsConfig{
+			Ranges:       all(tk.LogsRanges),
+			RecentRange:  10,
+			DeepRange:    10000,
+			Filters:      all(tk.LogsFilters),
+			MaxAddresses: 4,
+		}),
+		"storage": tk.NewStorageTracker(idGen, nil, window, maxEntries, all(tk.StorageMethods)),
+		"fee":     tk.NewFeeTracker(idGen, all(tk.FeeMethods)),
+		"code":    tk.NewCodeTracker(idGen, window, maxEntries),
+		"mempool": mempoolTracker,
+	}
+	applied := []tk.Tracker{erc20, erc721}
+	for name, tracker := range trackers {
+		if name != "erc20_balance" && name != "erc20_approval" && name != "erc721_owner" && name != "erc721_approval" {
+			applied = append(applied, tracker)
+		}
+	}
+	for _, raw := range c.blocks {
+		blk := tk.NewBlock(raw, c.signer)
+		for _, tracker := range applied {
+			err := tracker.ApplyBlock(blk)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Transactions of the last block are replayed as pending
+	for _, tx := range c.blocks[len(c.blocks)-1].Transactions() {
+		err := mempoolTracker.AddTransaction(tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name, tracker := range trackers {
+		if tracker.CurrentWeight() == 0 {
+			return nil, fmt.Errorf("empty %v tracker", name)
+		}
+	}
+	return trackers, nil
+}
+
+// all weights every option equally.
+func all(options []string) map[string]uint {
+	res := make(map[string]uint)
+	for _, option := range options {
+		res[option] = 1
+	}
+	return res
+}
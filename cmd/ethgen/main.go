@@ -4,17 +4,282 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/urfave/cli/v2"
 	"github.com/wcgcyx/ethgen/api"
 	"github.com/wcgcyx/ethgen/node"
 	"github.com/wcgcyx/ethgen/request"
+	"github.com/wcgcyx/ethgen/tracker"
 )
 
 type config struct {
 	ERC20  []string `json:"erc20"`
 	ERC721 []string `json:"erc721"`
+	// Slots of the balance mappings of ERC20 contracts, for state overrides
+	ERC20BalanceSlots map[string]uint64 `json:"erc20_balance_slots"`
+}
+
+// generateFlags are the weights of every workload kind and the block
+// parameters of generated queries.
+var generateFlags = []cli.Flag{
+	&cli.IntFlag{
+		Name:  "token_weight",
+		Value: 85,
+		Usage: "specify token weight",
+	},
+	&cli.IntFlag{
+		Name:  "tx_weight",
+		Value: 15,
+		Usage: "specify tx weight",
+	},
+	&cli.IntFlag{
+		Name:  "account_weight",
+		Value: 0,
+		Usage: "specify account (eth_getBalance, eth_getTransactionCount) weight",
+	},
+	&cli.IntFlag{
+		Name:  "logs_weight",
+		Value: 0,
+		Usage: "specify logs (eth_getLogs) weight",
+	},
+	&cli.IntFlag{
+		Name:  "lookup_weight",
+		Value: 0,
+		Usage: "specify transaction and receipt lookup weight",
+	},
+	&cli.IntFlag{
+		Name:  "block_weight",
+		Value: 0,
+		Usage: "specify block retrieval weight",
+	},
+	&cli.IntFlag{
+		Name:  "trace_weight",
+		Value: 0,
+		Usage: "specify tracing (debug_trace*, trace_*) weight",
+	},
+	&cli.IntFlag{
+		Name:  "storage_weight",
+		Value: 0,
+		Usage: "specify storage (eth_getStorageAt, eth_getProof) weight",
+	},
+	&cli.IntFlag{
+		Name:  "fee_weight",
+		Value: 0,
+		Usage: "specify fee market (eth_feeHistory, eth_gasPrice, eth_maxPriorityFeePerGas, eth_chainId, net_version) weight",
+	},
+	&cli.IntFlag{
+		Name:  "code_weight",
+		Value: 0,
+		Usage: "specify code (eth_getCode) weight",
+	},
+	&cli.IntFlag{
+		Name:  "mempool_weight",
+		Value: 0,
+		Usage: "specify pending transaction (eth_call, eth_estimateGas) weight",
+	},
+	&cli.StringFlag{
+		Name:  "block_tags",
+		Value: "",
+		Usage: "specify shares of block parameters, parent, latest, pending, safe, finalized, hash or recent, default of each tracker if empty",
+	},
+	&cli.IntFlag{
+		Name:  "recent_depth",
+		Value: 64,
+		Usage: "specify maximum depth of recent block parameters",
+	},
+	&cli.StringFlag{
+		Name:  "archive_depth",
+		Value: "uniform",
+		Usage: "specify depth distribution of archive block parameters, uniform, log or fixed",
+	},
+	&cli.IntFlag{
+		Name:  "archive_range",
+		Value: 100000,
+		Usage: "specify maximum depth of uniform archive block parameters",
+	},
+	&cli.StringFlag{
+		Name:  "archive_offsets",
+		Value: "",
+		Usage: "specify comma separated depths of fixed archive block parameters",
+	},
+	&cli.BoolFlag{
+		Name:  "from_snapshot",
+		Value: false,
+		Usage: "specify whether to sample token holders from the snapshot of the daemon",
+	},
+	&cli.IntFlag{
+		Name:  "override_share",
+		Value: 0,
+		Usage: "specify percentage of eth_call queries with a state override",
+	},
+}
+
+// weights gets the weights of every workload kind from the flags.
+func weights(c *cli.Context) map[string]uint {
+	return map[string]uint{
+		"token":   uint(c.Int("token_weight")),
+		"tx":      uint(c.Int("tx_weight")),
+		"account": uint(c.Int("account_weight")),
+		"logs":    uint(c.Int("logs_weight")),
+		"lookup":  uint(c.Int("lookup_weight")),
+		"block":   uint(c.Int("block_weight")),
+		"trace":   uint(c.Int("trace_weight")),
+		"storage": uint(c.Int("storage_weight")),
+		"fee":     uint(c.Int("fee_weight")),
+		"code":    uint(c.Int("code_weight")),
+		"mempool": uint(c.Int("mempool_weight")),
+	}
+}
+
+// generateOptions gets the options of generating queries from the flags.
+func generateOptions(c *cli.Context) (tracker.GenerateOptions, error) {
+	blockTags, err := tracker.ParseWeights(c.String("block_tags"), tracker.BlockTags...)
+	if err != nil {
+		return tracker.GenerateOptions{}, err
+	}
+	known := false
+	for _, name := range tracker.ArchiveDepths {
+		known = known || name == c.String("archive_depth")
+	}
+	if !known {
+		return tracker.GenerateOptions{}, fmt.Errorf("unknown archive depth %v, expect one of %v", c.String("archive_depth"), tracker.ArchiveDepths)
+	}
+	archiveOffsets := make([]uint, 0)
+	for _, item := range strings.Split(c.String("archive_offsets"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		offset, err := strconv.ParseUint(item, 10, 64)
+		if err != nil {
+			return tracker.GenerateOptions{}, fmt.Errorf("fail to parse archive offset %v: %v", item, err.Error())
+		}
+		archiveOffsets = append(archiveOffsets, uint(offset))
+	}
+	if c.Int("override_share") < 0 || c.Int("override_share") > 100 {
+		return tracker.GenerateOptions{}, fmt.Errorf("override share must be between 0 and 100")
+	}
+	if blockTags["archive"] > 0 && c.String("archive_depth") == "fixed" && len(archiveOffsets) == 0 {
+		return tracker.GenerateOptions{}, fmt.Errorf("fixed archive depth requires archive offsets")
+	}
+	return tracker.GenerateOptions{
+		BlockTags:      blockTags,
+		RecentDepth:    uint(c.Int("recent_depth")),
+		ArchiveDepth:   c.String("archive_depth"),
+		ArchiveRange:   uint(c.Int("archive_range")),
+		ArchiveOffsets: archiveOffsets,
+		Snapshot:       c.Bool("from_snapshot"),
+		OverrideShare:  uint(c.Int("override_share")),
+	}, nil
+}
+
+// options gets the tracker options from the daemon flags.
+func options(c *cli.Context) (node.Options, error) {
+	txMethods, err := tracker.ParseWeights(c.String("tx_methods"), tracker.TransactionMethods...)
+	if err != nil {
+		return node.Options{}, err
+	}
+	logsRanges, err := tracker.ParseWeights(c.String("logs_ranges"), tracker.LogsRanges...)
+	if err != nil {
+		return node.Options{}, err
+	}
+	logsFilters, err := tracker.ParseWeights(c.String("logs_filters"), tracker.LogsFilters...)
+	if err != nil {
+		return node.Options{}, err
+	}
+	lookupMethods, err := tracker.ParseWeights(c.String("lookup_methods"), tracker.TransactionLookupMethods...)
+	if err != nil {
+		return node.Options{}, err
+	}
+	blockMethods, err := tracker.ParseWeights(c.String("block_methods"), tracker.BlockMethods...)
+	if err != nil {
+		return node.Options{}, err
+	}
+	traceMethods, err := tracker.ParseWeights(c.String("trace_methods"), tracker.TraceMethods...)
+	if err != nil {
+		return node.Options{}, err
+	}
+	traceTracers, err := tracker.ParseWeights(c.String("trace_tracers"), tracker.TraceTracers...)
+	if err != nil {
+		return node.Options{}, err
+	}
+	storageMethods, err := tracker.ParseWeights(c.String("storage_methods"), tracker.StorageMethods...)
+	if err != nil {
+		return node.Options{}, err
+	}
+	feeMethods, err := tracker.ParseWeights(c.String("fee_methods"), tracker.FeeMethods...)
+	if err != nil {
+		return node.Options{}, err
+	}
+	txStrip := make(map[string]bool)
+	for _, field := range strings.Split(c.String("tx_strip"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		known := false
+		for _, name := range tracker.TransactionFields {
+			known = known || name == field
+		}
+		if !known {
+			return node.Options{}, fmt.Errorf("unknown transaction field %v, expect one of %v", field, tracker.TransactionFields)
+		}
+		txStrip[field] = true
+	}
+	mempoolMethods, err := tracker.ParseWeights(c.String("mempool_methods"), tracker.MempoolMethods...)
+	if err != nil {
+		return node.Options{}, err
+	}
+	// Every block keeps at least one entry of the cap.
+	if c.Int("max_entries") != 0 && c.Int("max_entries") < c.Int("window") {
+		return node.Options{}, fmt.Errorf("max entries must be 0 or at least the window %v, got %v", c.Int("window"), c.Int("max_entries"))
+	}
+	if c.Float64("block_skew") <= 0 {
+		return node.Options{}, fmt.Errorf("block skew must be positive, got %v", c.Float64("block_skew"))
+	}
+	if c.Int("mempool_size") <= 0 {
+		return node.Options{}, fmt.Errorf("mempool size must be positive, got %v", c.Int("mempool_size"))
+	}
+	var snapshot *tracker.Snapshot
+	if c.String("snapshot") != "" {
+		snapshot, err = tracker.LoadSnapshot(c.String("snapshot"))
+		if err != nil {
+			return node.Options{}, err
+		}
+	}
+	return node.Options{
+		Tx: tracker.TransactionConfig{
+			Methods: txMethods,
+			Strip:   txStrip,
+		},
+		LogsFetch: c.Bool("logs"),
+		Logs: tracker.LogsConfig{
+			Ranges:       logsRanges,
+			RecentRange:  uint(c.Int("logs_recent_range")),
+			DeepRange:    uint(c.Int("logs_deep_range")),
+			Filters:      logsFilters,
+			MaxAddresses: uint(c.Int("logs_max_addresses")),
+		},
+		LookupMethods: lookupMethods,
+		BlockMethods:  blockMethods,
+		BlockSkew:     c.Float64("block_skew"),
+		Trace: tracker.TraceConfig{
+			Methods:     traceMethods,
+			Tracers:     traceTracers,
+			StructLimit: uint(c.Int("trace_struct_limit")),
+		},
+		StorageMethods: storageMethods,
+		StorageTraces:  c.Bool("storage_traces"),
+		FeeMethods:     feeMethods,
+		Snapshot:       snapshot,
+		MempoolAp:      c.String("mempool_ap"),
+		MempoolSize:    uint(c.Int("mempool_size")),
+		MempoolMethods: mempoolMethods,
+		MaxEntries:     uint(c.Int("max_entries")),
+	}, nil
 }
 
 func main() {
@@ -30,6 +295,11 @@ func main() {
 						Value: 2880,
 						Usage: "specify window size",
 					},
+					&cli.IntFlag{
+						Name:  "max_entries",
+						Value: 0,
+						Usage: "specify maximum entries kept by every tracker, sampled by block, 0 for no cap or at least the window",
+					},
 					&cli.StringFlag{
 						Name:  "config",
 						Value: "",
@@ -45,6 +315,111 @@ func main() {
 						Value: "http://127.0.0.1:8545",
 						Usage: "specify chain access addr",
 					},
+					&cli.StringFlag{
+						Name:  "tx_methods",
+						Value: "call:100",
+						Usage: "specify weights of methods replaying transactions, call, estimate or access_list",
+					},
+					&cli.StringFlag{
+						Name:  "tx_strip",
+						Value: "",
+						Usage: "specify comma separated fields stripped from replayed transactions, value, gas, fees or access_list",
+					},
+					&cli.BoolFlag{
+						Name:  "logs",
+						Value: false,
+						Usage: "specify whether to learn logs for eth_getLogs queries, requiring eth_getLogs for every block",
+					},
+					&cli.StringFlag{
+						Name:  "logs_ranges",
+						Value: "single:40,recent:45,deep:15",
+						Usage: "specify weights of eth_getLogs block ranges, single, recent or deep",
+					},
+					&cli.IntFlag{
+						Name:  "logs_recent_range",
+						Value: 100,
+						Usage: "specify maximum blocks of recent eth_getLogs ranges",
+					},
+					&cli.IntFlag{
+						Name:  "logs_deep_range",
+						Value: 10000,
+						Usage: "specify maximum blocks of deep eth_getLogs ranges",
+					},
+					&cli.StringFlag{
+						Name:  "logs_filters",
+						Value: "address:15,event:40,indexed:20,topic:10,multi:15",
+						Usage: "specify weights of eth_getLogs filters, address, event, indexed, topic or multi",
+					},
+					&cli.IntFlag{
+						Name:  "logs_max_addresses",
+						Value: 5,
+						Usage: "specify maximum addresses of multi-address eth_getLogs filters",
+					},
+					&cli.StringFlag{
+						Name:  "lookup_methods",
+						Value: "tx:35,receipt:45,block_receipts:10,tx_by_index:10",
+						Usage: "specify weights of lookup methods, tx, receipt, block_receipts or tx_by_index",
+					},
+					&cli.StringFlag{
+						Name:  "block_methods",
+						Value: "number:25,number_full:20,hash:15,tx_count:10,uncle_count:5,block_number:25",
+						Usage: "specify weights of block methods, number, number_full, hash, tx_count, uncle_count or block_number",
+					},
+					&cli.Float64Flag{
+						Name:  "block_skew",
+						Value: 3,
+						Usage: "specify recency skew of queried blocks, 1 for uniform over the window",
+					},
+					&cli.StringFlag{
+						Name:  "trace_methods",
+						Value: "debug_tx:30,debug_call:20,debug_block:10,trace_block:10,trace_tx:15,trace_replay:15",
+						Usage: "specify weights of tracing methods, debug_tx, debug_call, debug_block, trace_block, trace_tx or trace_replay",
+					},
+					&cli.StringFlag{
+						Name:  "trace_tracers",
+						Value: "call:60,prestate:30,struct:10",
+						Usage: "specify weights of tracers, call, prestate or struct",
+					},
+					&cli.IntFlag{
+						Name:  "trace_struct_limit",
+						Value: 1000,
+						Usage: "specify maximum logs of the struct logger, 0 for unlimited",
+					},
+					&cli.StringFlag{
+						Name:  "storage_methods",
+						Value: "storage_at:70,proof:30",
+						Usage: "specify weights of storage methods, storage_at or proof",
+					},
+					&cli.BoolFlag{
+						Name:  "storage_traces",
+						Value: false,
+						Usage: "specify whether to learn touched storage from prestate traces, requiring debug_traceBlockByNumber",
+					},
+					&cli.StringFlag{
+						Name:  "fee_methods",
+						Value: "fee_history:30,gas_price:25,max_priority_fee:20,chain_id:20,net_version:5",
+						Usage: "specify weights of fee methods, fee_history, gas_price, max_priority_fee, chain_id or net_version",
+					},
+					&cli.StringFlag{
+						Name:  "snapshot",
+						Value: "",
+						Usage: "specify historical snapshot file of token holders for archive queries",
+					},
+					&cli.StringFlag{
+						Name:  "mempool_ap",
+						Value: "",
+						Usage: "specify websocket or IPC endpoint to follow pending transactions, none if empty",
+					},
+					&cli.IntFlag{
+						Name:  "mempool_size",
+						Value: 1000,
+						Usage: "specify maximum pending transactions kept",
+					},
+					&cli.StringFlag{
+						Name:  "mempool_methods",
+						Value: "call:50,estimate:50",
+						Usage: "specify weights of methods simulating pending transactions, call or estimate",
+					},
 				},
 				Action: func(c *cli.Context) error {
 					// First try to read config
@@ -57,7 +432,12 @@ func main() {
 					if err != nil {
 						return err
 					}
-					n, err := node.NewNode(uint(c.Int("window")), c.String("chain_ap"), cfg.ERC20, cfg.ERC721)
+					opts, err := options(c)
+					if err != nil {
+						return err
+					}
+					opts.ERC20BalanceSlots = cfg.ERC20BalanceSlots
+					n, err := node.NewNode(uint(c.Int("window")), c.String("chain_ap"), cfg.ERC20, cfg.ERC721, opts)
 					if err != nil {
 						return err
 					}
@@ -72,7 +452,7 @@ func main() {
 			},
 			{
 				Name: "generate",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.IntFlag{
 						Name:  "port",
 						Value: 9999,
@@ -88,17 +468,7 @@ func main() {
 						Value: 0,
 						Usage: "specify frequency",
 					},
-					&cli.IntFlag{
-						Name:  "token_weight",
-						Value: 85,
-						Usage: "specify token weight",
-					},
-					&cli.IntFlag{
-						Name:  "tx_weight",
-						Value: 15,
-						Usage: "specify tx weight",
-					},
-				},
+				}, generateFlags...),
 				Action: func(c *cli.Context) error {
 					// First try to get client
 					client, closer, err := api.NewClient(c.Context, c.Int("port"))
@@ -112,14 +482,18 @@ func main() {
 						return fmt.Errorf("daemon not ready to generate queries")
 					}
 					// Generate queries
+					opts, err := generateOptions(c)
+					if err != nil {
+						return err
+					}
 					duration := c.Duration("duration")
 					for {
-						queries, err := client.Generate(uint(c.Int("number")), uint(c.Int("token_weight")), uint(c.Int("tx_weight")))
+						queries, err := client.Generate(uint(c.Int("number")), weights(c), opts)
 						if err != nil {
 							return err
 						}
 						for _, query := range queries {
-							fmt.Println(query)
+							fmt.Println(query.Body)
 						}
 						if duration == 0 {
 							break
@@ -131,7 +505,7 @@ func main() {
 			},
 			{
 				Name: "request",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.IntFlag{
 						Name:  "port",
 						Value: 9999,
@@ -149,25 +523,115 @@ func main() {
 					},
 					&cli.IntFlag{
 						Name:  "concurrency",
-						Value: 5,
-						Usage: "specify concurrency",
+						Value: 1000,
+						Usage: "specify maximum queries in flight, queries are sent at their scheduled time up to it",
 					},
 					&cli.StringFlag{
 						Name:  "chain_ap",
 						Value: "http://127.0.0.1:8545",
 						Usage: "specify chain access addr",
 					},
+					&cli.BoolFlag{
+						Name:  "keepalive",
+						Value: true,
+						Usage: "specify whether to reuse http connections",
+					},
 					&cli.IntFlag{
-						Name:  "token_weight",
-						Value: 85,
-						Usage: "specify token weight",
+						Name:  "max_conns",
+						Value: 0,
+						Usage: "specify http/1.1 connection pool size, 0 for unlimited, not supported with http2",
+					},
+					&cli.BoolFlag{
+						Name:  "http2",
+						Value: false,
+						Usage: "specify whether to use http/2 (h2c for http endpoints)",
 					},
 					&cli.IntFlag{
-						Name:  "tx_weight",
-						Value: 15,
-						Usage: "specify tx weight",
+						Name:  "conns",
+						Value: 1,
+						Usage: "specify number of persistent ws/ipc connections",
 					},
-				},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Value: 10 * time.Second,
+						Usage: "specify deadline of every query, counted as failed if exceeded, 0 for none",
+					},
+					&cli.StringFlag{
+						Name:  "breakdown",
+						Value: "tracker",
+						Usage: "specify level of per category results, none, kind, tracker, contract or method",
+					},
+					&cli.IntFlag{
+						Name:  "prefetch",
+						Value: 2,
+						Usage: "specify number of batches generated ahead of sending",
+					},
+					&cli.StringFlag{
+						Name:  "profile",
+						Value: "",
+						Usage: "specify load profile, e.g. warmup:100:10s,ramp:100:1000:60s,steps:200:1000:200:30s",
+					},
+					&cli.StringFlag{
+						Name:  "profile_file",
+						Value: "",
+						Usage: "specify load profile file",
+					},
+					&cli.StringFlag{
+						Name:  "search",
+						Value: "",
+						Usage: "specify capacity search mode, bisect or aimd",
+					},
+					&cli.IntFlag{
+						Name:  "search_min",
+						Value: 10,
+						Usage: "specify minimum searched rate",
+					},
+					&cli.IntFlag{
+						Name:  "search_max",
+						Value: 10000,
+						Usage: "specify maximum searched rate",
+					},
+					&cli.DurationFlag{
+						Name:  "search_duration",
+						Value: 30 * time.Second,
+						Usage: "specify duration of every probe",
+					},
+					&cli.IntFlag{
+						Name:  "search_precision",
+						Value: 10,
+						Usage: "specify rate precision of bisection",
+					},
+					&cli.IntFlag{
+						Name:  "search_increase",
+						Value: 50,
+						Usage: "specify additive rate increase of aimd",
+					},
+					&cli.Float64Flag{
+						Name:  "search_decrease",
+						Value: 0.5,
+						Usage: "specify multiplicative rate decrease of aimd",
+					},
+					&cli.IntFlag{
+						Name:  "search_rounds",
+						Value: 20,
+						Usage: "specify number of probes of aimd",
+					},
+					&cli.Float64Flag{
+						Name:  "slo_percentile",
+						Value: 99,
+						Usage: "specify latency percentile of the objective",
+					},
+					&cli.DurationFlag{
+						Name:  "slo_latency",
+						Value: 100 * time.Millisecond,
+						Usage: "specify maximum latency at the percentile",
+					},
+					&cli.Float64Flag{
+						Name:  "slo_error_rate",
+						Value: 0.01,
+						Usage: "specify maximum error rate",
+					},
+				}, generateFlags...),
 				Action: func(c *cli.Context) error {
 					// First try to get client
 					client, closer, err := api.NewClient(c.Context, c.Int("port"))
@@ -180,22 +644,75 @@ func main() {
 					if !ready {
 						return fmt.Errorf("daemon not ready to generate queries")
 					}
+					// Connect to chain
+					transport, err := request.NewTransport(c.String("chain_ap"), request.TransportConfig{
+						KeepAlive: c.Bool("keepalive"),
+						MaxConns:  c.Int("max_conns"),
+						HTTP2:     c.Bool("http2"),
+						Conns:     c.Int("conns"),
+						Timeout:   c.Duration("timeout"),
+					})
+					if err != nil {
+						return err
+					}
+					defer transport.Close()
 					// Generate queries
-					duration := c.Duration("duration")
-					for {
-						queries, err := client.Generate(uint(c.Int("number")), uint(c.Int("token_weight")), uint(c.Int("tx_weight")))
-						if err != nil {
-							return err
-						}
-						err = request.Request(c.String("chain_ap"), queries, duration, c.Int("concurrency"))
+					level := c.String("breakdown")
+					opts, err := generateOptions(c)
+					if err != nil {
+						return err
+					}
+					generate := func(number uint) ([]request.Query, error) {
+						queries, err := client.Generate(number, weights(c), opts)
 						if err != nil {
-							return err
+							return nil, err
 						}
-						if duration == 0 {
-							break
+						res := make([]request.Query, len(queries))
+						for i, query := range queries {
+							categories := make([]string, 0)
+							if level != "none" {
+								categories = append(categories, query.Category("kind"))
+							}
+							if level != "none" && level != "kind" {
+								categories = append(categories, query.Category(level))
+							}
+							res[i] = request.Query{
+								Categories: categories,
+								Body:       query.Body,
+							}
 						}
+						return res, nil
 					}
-					return nil
+					runner := request.NewRunner(generate, transport, c.Duration("duration"), c.Int("concurrency"), c.Int("prefetch"))
+					if c.String("search") != "" {
+						_, err = runner.Search(request.SearchConfig{
+							Mode:      c.String("search"),
+							Min:       uint(c.Int("search_min")),
+							Max:       uint(c.Int("search_max")),
+							Duration:  c.Duration("search_duration"),
+							Precision: uint(c.Int("search_precision")),
+							Increase:  uint(c.Int("search_increase")),
+							Decrease:  c.Float64("search_decrease"),
+							Rounds:    c.Int("search_rounds"),
+						}, request.SLO{
+							Percentile: c.Float64("slo_percentile"),
+							Latency:    c.Duration("slo_latency"),
+							ErrorRate:  c.Float64("slo_error_rate"),
+						})
+						return err
+					}
+					var stages []request.Stage
+					if c.String("profile") != "" {
+						stages, err = request.ParseProfile(c.String("profile"))
+					} else if c.String("profile_file") != "" {
+						stages, err = request.LoadProfile(c.String("profile_file"))
+					} else {
+						return runner.Run(uint(c.Int("number")))
+					}
+					if err != nil {
+						return err
+					}
+					return runner.RunProfile(stages)
 				},
 			},
 		},
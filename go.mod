@@ -5,9 +5,11 @@ go 1.17
 require (
 	github.com/ethereum/go-ethereum v1.10.21
 	github.com/filecoin-project/go-jsonrpc v0.1.6
+	github.com/gorilla/websocket v1.4.2
 	github.com/mroth/weightedrand v0.4.1
 	github.com/sheerun/queue v1.0.1
 	github.com/urfave/cli/v2 v2.11.1
+	golang.org/x/net v0.0.0-20220722155237-a158d28d115b
 )
 
 require (
@@ -19,7 +21,6 @@ require (
 	github.com/go-ole/go-ole v1.2.1 // indirect
 	github.com/go-stack/stack v1.8.0 // indirect
 	github.com/golang/groupcache v0.0.0-20190702054246-869f871628b6 // indirect
-	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/ipfs/go-log/v2 v2.0.8 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	github.com/shirou/gopsutil v3.21.4-0.20210419000835-c7a38de76ee5+incompatible // indirect
@@ -32,6 +33,7 @@ require (
 	go.uber.org/zap v1.14.1 // indirect
 	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519 // indirect
 	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
+	golang.org/x/text v0.3.7 // indirect
 	golang.org/x/xerrors v0.0.0-20220517211312-f3a8303e98df // indirect
 	gopkg.in/natefinch/npipe.v2 v2.0.0-20160621034901-c1b8fa8bdcce // indirect
 )
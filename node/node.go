@@ -2,13 +2,18 @@ package node
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/big"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/sheerun/queue"
 	"github.com/wcgcyx/ethgen/idgen"
 	tk "github.com/wcgcyx/ethgen/tracker"
@@ -19,33 +24,123 @@ type Node struct {
 
 	window uint
 
-	client *ethclient.Client
+	client    *ethclient.Client
+	rpcClient *rpc.Client
+	// Signer recovering senders of blocks
+	signer types.Signer
 
-	tokenTracker tk.Tracker
-	txTracker    tk.Tracker
-	lock         sync.RWMutex
+	tokenTracker *tk.BatchTracker
+	// Mempool tracker following the mempool endpoint, empty if none
+	mempoolAp      string
+	mempoolTracker *tk.MempoolTracker
+	// Trackers of every workload kind, each publishing an immutable snapshot
+	// after every block so generation never waits on import
+	trackers map[string]tk.Tracker
 }
 
-func NewNode(window uint, ap string, erc20 []string, erc721 []string) (*Node, error) {
-	client, err := ethclient.Dial(ap)
+// Options are the configurations of trackers.
+type Options struct {
+	Tx   tk.TransactionConfig
+	Logs tk.LogsConfig
+	// Whether to fetch the logs of every block for eth_getLogs queries
+	LogsFetch bool
+	// Weights of transaction lookup methods
+	LookupMethods map[string]uint
+	// Weights of block methods and the recency skew of blocks
+	BlockMethods map[string]uint
+	BlockSkew    float64
+	Trace        tk.TraceConfig
+	// Weights of storage methods and whether touched storage is also
+	// learnt from prestate traces
+	StorageMethods map[string]uint
+	StorageTraces  bool
+	// Weights of fee methods
+	FeeMethods map[string]uint
+	// Historical snapshot of token holders, nil if none
+	Snapshot *tk.Snapshot
+	// Websocket or IPC endpoint of pending transactions, empty if none,
+	// the size of the rolling set and the weights of mempool methods
+	MempoolAp      string
+	MempoolSize    uint
+	MempoolMethods map[string]uint
+	// Slots of the balance mappings of ERC20 contracts by contract, the
+	// balances of others not being overridden
+	ERC20BalanceSlots map[string]uint64
+	// Cap of the entries kept by every tracker of keys or logs, sampled by
+	// block, zero for none
+	MaxEntries uint
+}
+
+func NewNode(window uint, ap string, erc20 []string, erc721 []string, opts Options) (*Node, error) {
+	rpcClient, err := rpc.Dial(ap)
+	if err != nil {
+		return nil, err
+	}
+	client := ethclient.NewClient(rpcClient)
+	// Senders are recovered by the latest signer of the chain of the endpoint
+	chainID, err := client.ChainID(context.Background())
 	if err != nil {
 		return nil, err
 	}
+	signer := types.LatestSignerForChainID(chainID)
 
 	idGen := idgen.NewIdGenerator()
+	snapshot := &tk.Snapshot{}
+	if opts.Snapshot != nil {
+		snapshot = opts.Snapshot
+	}
 	tokenTracker := tk.NewBatchTracker([]tk.Tracker{
-		tk.NewERC20BatchTracker(idGen, erc20, window),
-		tk.NewERC721BatchTracker(idGen, erc721, window),
+		tk.NewERC20BatchTracker(idGen, erc20, window, opts.MaxEntries, snapshot.ERC20, opts.ERC20BalanceSlots),
+		tk.NewERC721BatchTracker(idGen, erc721, window, opts.MaxEntries, snapshot.ERC721),
 	})
-	txTracker := tk.NewTransactionTracker(idGen, 3) // Near-head transaction, 3 blocks
+	txTracker := tk.NewTransactionTracker(idGen, 3, opts.Tx) // Near-head transaction, 3 blocks
+	lookupTracker := tk.NewTransactionLookupTracker(idGen, txTracker, opts.LookupMethods)
+	accountTracker := tk.NewAccountBatchTracker(idGen, window, opts.MaxEntries)
+	blockTracker := tk.NewBlockTracker(idGen, window, opts.BlockMethods, opts.BlockSkew)
+	traceTracker := tk.NewTraceTracker(idGen, txTracker, blockTracker, opts.Trace)
+	var storageFetcher tk.StorageFetcher
+	if opts.StorageTraces {
+		storageFetcher = func(number uint64) (types.AccessList, error) {
+			return prestateStorage(rpcClient, number)
+		}
+	}
+	storageTracker := tk.NewStorageTracker(idGen, storageFetcher, window, opts.MaxEntries, opts.StorageMethods)
+	feeTracker := tk.NewFeeTracker(idGen, opts.FeeMethods)
+	codeTracker := tk.NewCodeTracker(idGen, window, opts.MaxEntries)
+	mempoolTracker := tk.NewMempoolTracker(idGen, signer, opts.MempoolSize, opts.MempoolMethods, opts.Tx.Strip)
+	var logFetcher tk.LogFetcher
+	if opts.LogsFetch {
+		logFetcher = func(number uint64) ([]types.Log, error) {
+			return client.FilterLogs(context.Background(), ethereum.FilterQuery{
+				FromBlock: new(big.Int).SetUint64(number),
+				ToBlock:   new(big.Int).SetUint64(number),
+			})
+		}
+	}
+	logsTracker := tk.NewLogsTracker(idGen, logFetcher, window, opts.MaxEntries, opts.Logs)
 
 	return &Node{
-		ok:           false,
-		window:       window,
-		client:       client,
-		tokenTracker: tokenTracker,
-		txTracker:    txTracker,
-		lock:         sync.RWMutex{},
+		ok:             false,
+		window:         window,
+		client:         client,
+		rpcClient:      rpcClient,
+		signer:         signer,
+		tokenTracker:   tokenTracker,
+		mempoolAp:      opts.MempoolAp,
+		mempoolTracker: mempoolTracker,
+		trackers: map[string]tk.Tracker{
+			"token":   tokenTracker,
+			"tx":      txTracker,
+			"account": accountTracker,
+			"block":   blockTracker,
+			"logs":    logsTracker,
+			"lookup":  lookupTracker,
+			"trace":   traceTracker,
+			"storage": storageTracker,
+			"fee":     feeTracker,
+			"code":    codeTracker,
+			"mempool": mempoolTracker,
+		},
 	}, nil
 }
 
@@ -56,6 +151,10 @@ func (n *Node) OK() bool {
 func (n *Node) Run() {
 	ctx := context.Background()
 
+	if n.mempoolAp != "" {
+		go n.followMempool(ctx)
+	}
+
 	blkQueue := queue.New()
 	go func() {
 		go func() {
@@ -63,7 +162,7 @@ func (n *Node) Run() {
 			if err != nil {
 				panic(err)
 			}
-			blk, err := n.client.BlockByNumber(ctx, big.NewInt(int64(last)))
+			blk, err := n.blockByNumber(ctx, last)
 			if err != nil {
 				panic(err)
 			}
@@ -75,7 +174,7 @@ func (n *Node) Run() {
 					fmt.Printf("Fail to get block head: %v\n", err.Error())
 				} else {
 					for i := last + 1; i <= current; i++ {
-						blk, err := n.client.BlockByNumber(ctx, big.NewInt(int64(i)))
+						blk, err := n.blockByNumber(ctx, i)
 						if err != nil {
 							fmt.Printf("Fail to get block for %v: %v\n", i, err.Error())
 						} else {
@@ -98,7 +197,7 @@ func (n *Node) Run() {
 			// No block  yet
 			continue
 		}
-		blk := item.(*types.Block)
+		blk := item.(*block)
 		headHeight = blk.NumberU64()
 		fmt.Printf("New head arrived: %v, start syncing...\n", blk.NumberU64())
 		break
@@ -106,69 +205,245 @@ func (n *Node) Run() {
 
 	currentHeight := uint64(0)
 	for currentHeight = headHeight - uint64(n.window); currentHeight < headHeight; currentHeight++ {
-		blk, err := n.client.BlockByNumber(ctx, big.NewInt(int64(currentHeight)))
+		blk, err := n.blockByNumber(ctx, currentHeight)
 		if err != nil {
 			fmt.Printf("Warn: fail to get block %v: %v\n", currentHeight, err.Error())
 			continue
 		}
-		err = n.tokenTracker.ApplyBlock(blk)
-		if err != nil {
-			fmt.Printf("Warn: fail to apply block at token tracker: %v\n", err.Error())
-		}
-		err = n.txTracker.ApplyBlock(blk)
-		if err != nil {
-			fmt.Printf("Warn: fail to apply block at tx tracker: %v\n", err.Error())
-		}
+		n.applyBlock(blk)
 		fmt.Printf("Imported blk: %v, target %v, diff %v\n", currentHeight, headHeight, headHeight-currentHeight)
-		fmt.Printf("\tERC20: %v\n", n.tokenTracker.(*tk.BatchTracker).Trackers()[0].Status())
-		fmt.Printf("\tERC721: %v\n", n.tokenTracker.(*tk.BatchTracker).Trackers()[1].Status())
-		fmt.Printf("\tTxn: %v\n", n.txTracker.Status())
+		n.printStatus()
 	}
 	fmt.Println("Ready to generate queries...")
 	n.ok = true
 	for {
 		item := blkQueue.Pop()
-		blk := item.(*types.Block)
-		n.lock.Lock()
-		err := n.tokenTracker.ApplyBlock(blk)
+		blk := item.(*block)
+		n.applyBlock(blk)
+		fmt.Printf("Imported blk: %v\n", blk.NumberU64())
+		n.printStatus()
+	}
+}
+
+// kinds gets the sorted workload kinds.
+func (n *Node) kinds() []string {
+	kinds := make([]string, 0)
+	for kind := range n.trackers {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// applyBlock decodes a block once and applies it to every tracker.
+func (n *Node) applyBlock(raw *block) {
+	blk := tk.NewBlockWithPositions(raw.Block, raw.positions, n.signer)
+	if blk.Skipped > 0 {
+		fmt.Printf("Warn: skipped %v transactions with unknown senders in block %v\n", blk.Skipped, blk.Number)
+	}
+	if blk.Malformed > 0 {
+		fmt.Printf("Warn: skipped %v token calls with short data in block %v\n", blk.Malformed, blk.Number)
+	}
+	for _, kind := range n.kinds() {
+		err := n.trackers[kind].ApplyBlock(blk)
 		if err != nil {
-			fmt.Printf("Warn: fail to apply block at token tracker: %v\n", err.Error())
+			fmt.Printf("Warn: fail to apply block at %v tracker: %v\n", kind, err.Error())
 		}
-		err = n.txTracker.ApplyBlock(blk)
-		if err != nil {
-			fmt.Printf("Warn: fail to apply block at tx tracker: %v\n", err.Error())
+	}
+}
+
+// block is a fetched block, with the positions of its transactions in the
+// original block.
+type block struct {
+	*types.Block
+	positions []uint
+}
+
+// blockByNumber gets a block with full transactions, skipping transactions
+// of types unknown to the client, such as L2 deposit and system transactions
+// and blob transactions.
+func (n *Node) blockByNumber(ctx context.Context, number uint64) (*block, error) {
+	var raw json.RawMessage
+	err := n.rpcClient.CallContext(ctx, &raw, "eth_getBlockByNumber", fmt.Sprintf("0x%x", number), true)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, fmt.Errorf("block %v not found", number)
+	}
+	header := new(types.Header)
+	err = json.Unmarshal(raw, header)
+	if err != nil {
+		return nil, err
+	}
+	var body struct {
+		Transactions []json.RawMessage `json:"transactions"`
+	}
+	err = json.Unmarshal(raw, &body)
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]*types.Transaction, 0, len(body.Transactions))
+	positions := make([]uint, 0, len(body.Transactions))
+	skipped := 0
+	for i, data := range body.Transactions {
+		tx := new(types.Transaction)
+		if tx.UnmarshalJSON(data) != nil {
+			skipped++
+			continue
 		}
-		fmt.Printf("Imported blk: %v\n", blk.NumberU64())
-		fmt.Printf("\tERC20: %v\n", n.tokenTracker.(*tk.BatchTracker).Trackers()[0].Status())
-		fmt.Printf("\tERC721: %v\n", n.tokenTracker.(*tk.BatchTracker).Trackers()[1].Status())
-		fmt.Printf("\tTxn: %v\n", n.txTracker.Status())
-		n.lock.Unlock()
+		txs = append(txs, tx)
+		positions = append(positions, uint(i))
+	}
+	if skipped > 0 {
+		fmt.Printf("Skipped %v transactions of unsupported types in block %v\n", skipped, number)
+	}
+	return &block{
+		Block:     types.NewBlockWithHeader(header).WithBody(txs, nil),
+		positions: positions,
+	}, nil
+}
+
+// followMempool follows the pending transactions of the mempool endpoint,
+// resubscribing on failures.
+func (n *Node) followMempool(ctx context.Context) {
+	for {
+		err := n.subscribeMempool(ctx)
+		fmt.Printf("Fail to follow mempool: %v\n", err.Error())
+		time.Sleep(time.Second * 15)
+	}
+}
+
+// subscribeMempool subscribes to full pending transactions until the
+// subscription fails.
+func (n *Node) subscribeMempool(ctx context.Context) error {
+	client, err := rpc.DialContext(ctx, n.mempoolAp)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	txs := make(chan json.RawMessage, 1024)
+	sub, err := client.EthSubscribe(ctx, txs, "newPendingTransactions", true)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case err := <-sub.Err():
+			if err == nil {
+				err = fmt.Errorf("subscription closed")
+			}
+			return err
+		case data := <-txs:
+			// Hashes and unknown transaction types are skipped
+			tx := new(types.Transaction)
+			if tx.UnmarshalJSON(data) != nil {
+				continue
+			}
+			err = n.mempoolTracker.AddTransaction(tx)
+			if err != nil {
+				fmt.Printf("Warn: fail to add pending transaction %v: %v\n", tx.Hash(), err.Error())
+			}
+		}
+	}
+}
+
+// prestateStorage gets the storage slots touched in a block from its
+// prestate traces.
+func prestateStorage(client *rpc.Client, number uint64) (types.AccessList, error) {
+	var traces []struct {
+		Result map[common.Address]struct {
+			Storage map[common.Hash]common.Hash `json:"storage"`
+		} `json:"result"`
+	}
+	err := client.CallContext(context.Background(), &traces, "debug_traceBlockByNumber", fmt.Sprintf("0x%x", number), map[string]string{"tracer": "prestateTracer"})
+	if err != nil {
+		return nil, err
 	}
+	res := make(types.AccessList, 0)
+	for _, trace := range traces {
+		for address, account := range trace.Result {
+			tuple := types.AccessTuple{
+				Address:     address,
+				StorageKeys: make([]common.Hash, 0),
+			}
+			for slot := range account.Storage {
+				tuple.StorageKeys = append(tuple.StorageKeys, slot)
+			}
+			if len(tuple.StorageKeys) > 0 {
+				res = append(res, tuple)
+			}
+		}
+	}
+	return res, nil
+}
+
+// printStatus prints the status of every tracker, with the estimated memory
+// held by its state.
+func (n *Node) printStatus() {
+	memory := uint64(0)
+	report := func(name string, tracker tk.Tracker) {
+		held := tracker.Memory()
+		memory += held
+		fmt.Printf("\t%v: %v [%v]\n", name, tracker.Status(), common.StorageSize(held))
+	}
+	report("ERC20", n.tokenTracker.Trackers()[0])
+	report("ERC721", n.tokenTracker.Trackers()[1])
+	for _, kind := range n.kinds() {
+		if kind != "token" {
+			report(kind, n.trackers[kind])
+		}
+	}
+	fmt.Printf("\tMemory: %v\n", common.StorageSize(memory))
 }
 
-func (n *Node) GenerateQuery(number uint, tokenWeight uint, txWeight uint) ([]string, error) {
-	n.lock.RLock()
-	defer n.lock.RUnlock()
-	number1 := number * tokenWeight / (tokenWeight + txWeight)
-	number2 := number - number1
-	var res1 []string
-	var res2 []string
-	var err1 error
-	var err2 error
+// GenerateQuery generates the given number of queries, shared among the
+// workload kinds by their weights.
+func (n *Node) GenerateQuery(number uint, weights map[string]uint, opts tk.GenerateOptions) ([]tk.Query, error) {
+	total := uint(0)
+	kinds := make([]string, 0)
+	for _, kind := range n.kinds() {
+		if weights[kind] > 0 {
+			total += weights[kind]
+			kinds = append(kinds, kind)
+		}
+	}
+	for kind := range weights {
+		if _, ok := n.trackers[kind]; !ok {
+			return nil, fmt.Errorf("unknown workload kind %v", kind)
+		}
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("zero total weight")
+	}
+	counts := make([]uint, len(kinds))
+	remaining := number
+	for i, kind := range kinds {
+		if i == len(kinds)-1 {
+			counts[i] = remaining
+		} else {
+			counts[i] = number * weights[kind] / total
+			remaining -= counts[i]
+		}
+	}
+	resList := make([][]tk.Query, len(kinds))
+	errs := make([]error, len(kinds))
 	wg := sync.WaitGroup{}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		res1, err1 = n.tokenTracker.GenerateQuery(number1)
-	}()
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		res2, err2 = n.txTracker.GenerateQuery(number2)
-	}()
+	for i, kind := range kinds {
+		wg.Add(1)
+		go func(i int, tracker tk.Tracker) {
+			defer wg.Done()
+			resList[i], errs[i] = tracker.GenerateQuery(counts[i], opts)
+		}(i, n.trackers[kind])
+	}
 	wg.Wait()
-	if err1 != nil || err2 != nil {
-		return nil, fmt.Errorf("%v-%v", err1, err2)
+	res := make([]tk.Query, 0, number)
+	for i, kind := range kinds {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("fail to generate %v queries: %v", kind, errs[i])
+		}
+		res = append(res, resList[i]...)
 	}
-	return append(res1, res2...), nil
+	return res, nil
 }
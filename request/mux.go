@@ -0,0 +1,238 @@
+package request
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// codec reads and writes JSON-RPC messages over a persistent connection.
+type codec interface {
+	read() ([]byte, error)
+	write(msg []byte) error
+	close() error
+}
+
+type wsCodec struct {
+	conn *websocket.Conn
+}
+
+func dialWS(url string) (codec, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &wsCodec{conn: conn}, nil
+}
+
+func (c *wsCodec) read() ([]byte, error) {
+	_, msg, err := c.conn.ReadMessage()
+	return msg, err
+}
+
+func (c *wsCodec) write(msg []byte) error {
+	return c.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+func (c *wsCodec) close() error {
+	return c.conn.Close()
+}
+
+type ipcCodec struct {
+	conn net.Conn
+	dec  *json.Decoder
+}
+
+func dialIPC(path string) (codec, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &ipcCodec{conn: conn, dec: json.NewDecoder(conn)}, nil
+}
+
+func (c *ipcCodec) read() ([]byte, error) {
+	var msg json.RawMessage
+	err := c.dec.Decode(&msg)
+	return msg, err
+}
+
+func (c *ipcCodec) write(msg []byte) error {
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+func (c *ipcCodec) close() error {
+	return c.conn.Close()
+}
+
+// message is the part of a JSON-RPC message used for multiplexing.
+type message struct {
+	ID    json.RawMessage `json:"id"`
+	Error json.RawMessage `json:"error"`
+}
+
+// succeeded checks if the message is a response without error.
+func (m message) succeeded() bool {
+	return len(m.Error) == 0 || string(m.Error) == "null"
+}
+
+// muxConn is a persistent connection with multiple in-flight queries,
+// matched to their responses by id.
+type muxConn struct {
+	codec   codec
+	timeout time.Duration
+
+	wLock sync.Mutex
+
+	lock    sync.Mutex
+	pending map[string]chan message
+	err     error
+}
+
+func newMuxConn(c codec, timeout time.Duration) *muxConn {
+	conn := &muxConn{
+		codec:   c,
+		timeout: timeout,
+		wLock:   sync.Mutex{},
+		lock:    sync.Mutex{},
+		pending: make(map[string]chan message),
+	}
+	go conn.readLoop()
+	return conn
+}
+
+func (c *muxConn) readLoop() {
+	for {
+		data, err := c.codec.read()
+		if err != nil {
+			c.lock.Lock()
+			c.err = err
+			for id, ch := range c.pending {
+				close(ch)
+				delete(c.pending, id)
+			}
+			c.lock.Unlock()
+			return
+		}
+		msg := message{}
+		err = json.Unmarshal(data, &msg)
+		if err != nil {
+			fmt.Printf("Fail to decode response: %v\n", err.Error())
+			continue
+		}
+		c.lock.Lock()
+		ch, ok := c.pending[string(msg.ID)]
+		if ok {
+			delete(c.pending, string(msg.ID))
+		}
+		c.lock.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+}
+
+func (c *muxConn) send(query Prepared) (bool, error) {
+	ch := make(chan message, 1)
+	c.lock.Lock()
+	if c.err != nil {
+		c.lock.Unlock()
+		return false, c.err
+	}
+	c.pending[query.id] = ch
+	c.lock.Unlock()
+	c.wLock.Lock()
+	err := c.codec.write(query.body)
+	c.wLock.Unlock()
+	if err != nil {
+		c.lock.Lock()
+		delete(c.pending, query.id)
+		c.lock.Unlock()
+		return false, err
+	}
+	var timeout <-chan time.Time
+	if c.timeout > 0 {
+		timer := time.NewTimer(c.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			return false, fmt.Errorf("connection closed: %v", c.err)
+		}
+		return resp.succeeded(), nil
+	case <-timeout:
+		// A late response is dropped by the read loop.
+		c.lock.Lock()
+		delete(c.pending, query.id)
+		c.lock.Unlock()
+		return false, fmt.Errorf("query timed out after %v", c.timeout)
+	}
+}
+
+// muxTransport spreads queries over a fixed set of persistent connections.
+type muxTransport struct {
+	conns  []*muxConn
+	next   uint64
+	nextID uint64
+}
+
+func newMuxTransport(conns int, timeout time.Duration, dial func() (codec, error)) (*muxTransport, error) {
+	if conns <= 0 {
+		conns = 1
+	}
+	t := &muxTransport{
+		conns: make([]*muxConn, 0),
+	}
+	for i := 0; i < conns; i++ {
+		c, err := dial()
+		if err != nil {
+			t.Close()
+			return nil, err
+		}
+		t.conns = append(t.conns, newMuxConn(c, timeout))
+	}
+	return t, nil
+}
+
+func (t *muxTransport) Prepare(query string) (Prepared, error) {
+	// Queries from different trackers may share ids, so every query is given
+	// an id unique to the transport.
+	req := make(map[string]json.RawMessage)
+	err := json.Unmarshal([]byte(query), &req)
+	if err != nil {
+		return Prepared{}, err
+	}
+	id := strconv.FormatUint(atomic.AddUint64(&t.nextID, 1), 10)
+	req["id"] = json.RawMessage(id)
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Prepared{}, err
+	}
+	return Prepared{body: body, id: id}, nil
+}
+
+func (t *muxTransport) Send(query Prepared) (bool, error) {
+	i := atomic.AddUint64(&t.next, 1)
+	return t.conns[i%uint64(len(t.conns))].send(query)
+}
+
+func (t *muxTransport) Close() error {
+	var err error
+	for _, conn := range t.conns {
+		if cerr := conn.codec.close(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
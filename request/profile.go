@@ -0,0 +1,159 @@
+package request
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stage is a stage of a load profile, with a rate changing linearly from
+// From to To queries per second over the duration.
+type Stage struct {
+	Name     string
+	From     uint
+	To       uint
+	Duration time.Duration
+	// Warmup stages are excluded from the statistics.
+	Warmup bool
+}
+
+// Rate gets the target rate at the given elapsed time of the stage.
+func (s Stage) Rate(elapsed time.Duration) float64 {
+	if s.Duration <= 0 || elapsed >= s.Duration {
+		return float64(s.To)
+	}
+	return float64(s.From) + (float64(s.To)-float64(s.From))*elapsed.Seconds()/s.Duration.Seconds()
+}
+
+// ParseProfile parses a comma separated list of stages:
+//
+//	warmup:RATE:DURATION
+//	step:RATE:DURATION
+//	ramp:FROM:TO:DURATION
+//	steps:FROM:TO:INCREMENT:DURATION (a step for every rate from FROM to TO)
+func ParseProfile(spec string) ([]Stage, error) {
+	stages := make([]Stage, 0)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		fields := strings.Split(item, ":")
+		var err error
+		var nums []uint
+		var duration time.Duration
+		switch fields[0] {
+		case "warmup", "step":
+			nums, duration, err = parseStageFields(fields, 1)
+			if err != nil {
+				return nil, fmt.Errorf("fail to parse %v: %v", item, err.Error())
+			}
+			stages = append(stages, Stage{
+				Name:     fmt.Sprintf("%v %v/s", fields[0], nums[0]),
+				From:     nums[0],
+				To:       nums[0],
+				Duration: duration,
+				Warmup:   fields[0] == "warmup",
+			})
+		case "ramp":
+			nums, duration, err = parseStageFields(fields, 2)
+			if err != nil {
+				return nil, fmt.Errorf("fail to parse %v: %v", item, err.Error())
+			}
+			stages = append(stages, Stage{
+				Name:     fmt.Sprintf("ramp %v-%v/s", nums[0], nums[1]),
+				From:     nums[0],
+				To:       nums[1],
+				Duration: duration,
+			})
+		case "steps":
+			nums, duration, err = parseStageFields(fields, 3)
+			if err != nil {
+				return nil, fmt.Errorf("fail to parse %v: %v", item, err.Error())
+			}
+			if nums[2] == 0 {
+				return nil, fmt.Errorf("fail to parse %v: zero increment", item)
+			}
+			for rate := nums[0]; rate <= nums[1]; rate += nums[2] {
+				stages = append(stages, Stage{
+					Name:     fmt.Sprintf("step %v/s", rate),
+					From:     rate,
+					To:       rate,
+					Duration: duration,
+				})
+			}
+		default:
+			return nil, fmt.Errorf("unknown stage type %v", fields[0])
+		}
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("empty profile")
+	}
+	return stages, nil
+}
+
+func parseStageFields(fields []string, nums int) ([]uint, time.Duration, error) {
+	if len(fields) != nums+2 {
+		return nil, 0, fmt.Errorf("expect %v fields, got %v", nums+2, len(fields))
+	}
+	res := make([]uint, nums)
+	for i := 0; i < nums; i++ {
+		num, err := strconv.ParseUint(fields[i+1], 10, 64)
+		if err != nil {
+			return nil, 0, err
+		}
+		res[i] = uint(num)
+	}
+	duration, err := time.ParseDuration(fields[nums+1])
+	if err != nil {
+		return nil, 0, err
+	}
+	return res, duration, nil
+}
+
+type stageJSON struct {
+	Name     string `json:"name"`
+	From     uint   `json:"from"`
+	To       uint   `json:"to"`
+	Duration string `json:"duration"`
+	Warmup   bool   `json:"warmup"`
+}
+
+// LoadProfile loads stages from a json file, containing a list of
+// {"name": ..., "from": ..., "to": ..., "duration": ..., "warmup": ...}.
+func LoadProfile(path string) ([]Stage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]stageJSON, 0)
+	err = json.Unmarshal(data, &items)
+	if err != nil {
+		return nil, err
+	}
+	stages := make([]Stage, 0)
+	for i, item := range items {
+		duration, err := time.ParseDuration(item.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse duration of stage %v: %v", i, err.Error())
+		}
+		name := item.Name
+		if name == "" {
+			name = fmt.Sprintf("stage %v", i)
+		}
+		stages = append(stages, Stage{
+			Name:     name,
+			From:     item.From,
+			To:       item.To,
+			Duration: duration,
+			Warmup:   item.Warmup,
+		})
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("empty profile")
+	}
+	return stages, nil
+}
@@ -1,125 +1,67 @@
 package request
 
 import (
-	"bytes"
 	"fmt"
-	"math"
-	"net/http"
 	"sync"
 	"time"
 )
 
-func Request(url string, queries []string, duration time.Duration, concurrency int) error {
-	if concurrency <= 0 {
-		return fmt.Errorf("Concurrency must be positive number, got %v", concurrency)
+// Query is a query to send, reported under its categories.
+type Query struct {
+	Categories []string
+	Body       string
+}
+
+// Request sends the queries evenly over the duration and returns the result.
+//
+// Queries are sent open-loop: every query is sent at its scheduled time
+// whether earlier queries are answered or not, with at most maxInFlight
+// queries in flight. A query waiting for a free slot is sent late, and its
+// latency is measured from its scheduled time, so queueing under overload
+// counts towards latency.
+func Request(transport Transport, queries []Query, duration time.Duration, maxInFlight int) (*Result, error) {
+	if maxInFlight <= 0 {
+		return nil, fmt.Errorf("Concurrency must be positive number, got %v", maxInFlight)
 	}
-	actors := make([]*Actor, 0)
+	res := NewResult()
+	lock := sync.Mutex{}
+	add := func(query Query, latency time.Duration, ok bool, failed bool) {
+		lock.Lock()
+		defer lock.Unlock()
+		res.add(query.Categories, latency, ok, failed)
+	}
+	slots := make(chan struct{}, maxInFlight)
 	wg := sync.WaitGroup{}
+	delay := time.Duration(0)
+	if len(queries) > 0 {
+		delay = duration / time.Duration(len(queries))
+	}
 	start := time.Now()
-	for i := 0; i < concurrency; i++ {
-		subLen := len(queries) / concurrency
-		var subQueries []string
-		if i != concurrency-1 {
-			subQueries = queries[subLen*i : subLen*(i+1)]
-		} else {
-			subQueries = queries[subLen*i:]
+	for i, query := range queries {
+		scheduled := start.Add(time.Duration(i) * delay)
+		// Prepare ahead of the scheduled time.
+		prepared, err := transport.Prepare(query.Body)
+		if err != nil {
+			fmt.Printf("Fail to prepare request: %v\n", err.Error())
+			add(query, 0, false, true)
+			continue
 		}
-		// New actor
-		actor := newActor(url, subQueries, duration/time.Duration(len(subQueries)))
-		actors = append(actors, actor)
+		time.Sleep(time.Until(scheduled))
+		slots <- struct{}{}
 		wg.Add(1)
-		go func() {
+		go func(query Query, prepared Prepared, scheduled time.Time) {
 			defer wg.Done()
-			actor.start()
-		}()
-	}
-	wg.Wait()
-	end := time.Now()
-	// Report.
-	report(start, end, actors)
-	return nil
-}
-
-type Actor struct {
-	url    string
-	client *http.Client
-
-	queries []string
-	delay   time.Duration
-
-	result  []time.Duration
-	succeed int
-}
-
-func newActor(url string, queries []string, delay time.Duration) *Actor {
-	return &Actor{
-		url:     url,
-		client:  &http.Client{},
-		queries: queries,
-		delay:   delay,
-		result:  make([]time.Duration, 0),
-		succeed: 0,
-	}
-}
-
-func (a *Actor) start() {
-	for i := 0; i < len(a.queries); i++ {
-		// request.
-		req, err := http.NewRequest("POST", a.url, bytes.NewReader([]byte(a.queries[i])))
-		if err != nil {
-			fmt.Printf("Fail to generate request: %v\n", err.Error())
-		} else {
-			req.Close = true
-			req.Header.Set("Content-Type", "application/json")
-			start := time.Now()
-			resp, err := a.client.Do(req)
+			ok, err := transport.Send(prepared)
+			latency := time.Since(scheduled)
+			<-slots
 			if err != nil {
 				fmt.Printf("Fail to request: %v\n", err.Error())
-			} else {
-				// Add result
-				// TODO: Failed request?
-				resp.Body.Close()
-				a.result = append(a.result, time.Now().Sub(start))
-				if resp.StatusCode == 200 {
-					a.succeed++
-				}
-			}
-		}
-		time.Sleep(a.delay)
-	}
-}
-
-func report(start time.Time, end time.Time, actors []*Actor) {
-	min := time.Duration(math.MaxInt64)
-	max := time.Duration(0)
-	total := time.Duration(0)
-	count := 0
-	succeed := 0
-	for _, actor := range actors {
-		for _, res := range actor.result {
-			if res > max {
-				max = res
-			}
-			if res < min {
-				min = res
 			}
-			total += res
-			count++
-		}
-		succeed += actor.succeed
-	}
-	if count == 0 {
-		fmt.Printf("Performance result at %v: max %v, min %v, avg NA, std NA, time taken %v, succeed/total: %v/%v\n", time.Now(), max, min, end.Sub(start), succeed, count)
-	} else {
-		// Calculate variance
-		variance := time.Duration(0)
-		avg := total / time.Duration(count)
-		for _, actor := range actors {
-			for _, res := range actor.result {
-				variance += (res - avg) * (res - avg)
-			}
-		}
-		std := time.Duration(int64(math.Sqrt(float64(variance) / float64(count))))
-		fmt.Printf("Performance result at %v: max %v, min %v, avg %v, std %v, time taken %v, succeed/total: %v/%v\n", time.Now(), max, min, avg, std, end.Sub(start), succeed, count)
+			add(query, latency, ok, err != nil)
+		}(query, prepared, scheduled)
 	}
+	wg.Wait()
+	time.Sleep(time.Until(start.Add(duration)))
+	res.Elapsed = time.Since(start)
+	return res, nil
 }
@@ -0,0 +1,152 @@
+package request
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Result is the outcome of sending queries.
+type Result struct {
+	// Elapsed is the time spent sending queries.
+	Elapsed time.Duration
+	// Latencies of all answered queries.
+	Latencies []time.Duration
+	// Succeed is the number of succeeded queries.
+	Succeed int
+	// Failed is the number of queries failed to be sent.
+	Failed int
+	// Categories are the results of every category of queries.
+	Categories map[string]*Result
+}
+
+func NewResult() *Result {
+	return &Result{
+		Elapsed:    0,
+		Latencies:  make([]time.Duration, 0),
+		Succeed:    0,
+		Failed:     0,
+		Categories: make(map[string]*Result),
+	}
+}
+
+// add adds the outcome of a query to the result and to its categories.
+func (r *Result) add(categories []string, latency time.Duration, ok bool, failed bool) {
+	results := []*Result{r}
+	for _, category := range categories {
+		sub, exists := r.Categories[category]
+		if !exists {
+			sub = NewResult()
+			r.Categories[category] = sub
+		}
+		results = append(results, sub)
+	}
+	for _, res := range results {
+		if failed {
+			res.Failed++
+			continue
+		}
+		res.Latencies = append(res.Latencies, latency)
+		if ok {
+			res.Succeed++
+		}
+	}
+}
+
+// Merge adds the other result to this result.
+func (r *Result) Merge(other *Result) {
+	r.Elapsed += other.Elapsed
+	r.Latencies = append(r.Latencies, other.Latencies...)
+	r.Succeed += other.Succeed
+	r.Failed += other.Failed
+	for category, sub := range other.Categories {
+		if _, ok := r.Categories[category]; !ok {
+			r.Categories[category] = NewResult()
+		}
+		r.Categories[category].Merge(sub)
+	}
+}
+
+// Count gets the number of answered queries.
+func (r *Result) Count() int {
+	return len(r.Latencies)
+}
+
+// ErrorRate gets the ratio of queries that are failed or not succeeded.
+func (r *Result) ErrorRate() float64 {
+	total := r.Count() + r.Failed
+	if total == 0 {
+		return 0
+	}
+	return float64(total-r.Succeed) / float64(total)
+}
+
+// Throughput gets the number of answered queries per second.
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Count()) / r.Elapsed.Seconds()
+}
+
+// Percentile gets the latency at the given percentile in [0, 100].
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(r.Latencies))
+	copy(sorted, r.Latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
+
+// Report prints the result.
+func (r *Result) Report(name string) {
+	min := time.Duration(math.MaxInt64)
+	max := time.Duration(0)
+	total := time.Duration(0)
+	for _, res := range r.Latencies {
+		if res > max {
+			max = res
+		}
+		if res < min {
+			min = res
+		}
+		total += res
+	}
+	count := r.Count()
+	if count == 0 {
+		fmt.Printf("%v result at %v: max %v, min %v, avg NA, std NA, p50 NA, p90 NA, p99 NA, time taken %v, succeed/total: %v/%v, failed: %v\n", name, time.Now(), max, min, r.Elapsed, r.Succeed, count, r.Failed)
+	} else {
+		// Calculate variance
+		variance := time.Duration(0)
+		avg := total / time.Duration(count)
+		for _, res := range r.Latencies {
+			variance += (res - avg) * (res - avg)
+		}
+		std := time.Duration(int64(math.Sqrt(float64(variance) / float64(count))))
+		fmt.Printf("%v result at %v: max %v, min %v, avg %v, std %v, p50 %v, p90 %v, p99 %v, time taken %v, succeed/total: %v/%v, failed: %v\n", name, time.Now(), max, min, avg, std, r.Percentile(50), r.Percentile(90), r.Percentile(99), r.Elapsed, r.Succeed, count, r.Failed)
+	}
+}
+
+// ReportCategories prints the result of every category.
+func (r *Result) ReportCategories() {
+	categories := make([]string, 0)
+	for category := range r.Categories {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		sub := r.Categories[category]
+		throughput := 0.0
+		if r.Elapsed > 0 {
+			throughput = float64(sub.Count()) / r.Elapsed.Seconds()
+		}
+		fmt.Printf("\t%v: throughput %.2f/s, error rate %.4f, p50 %v, p90 %v, p99 %v, succeed/total: %v/%v, failed: %v\n", category, throughput, sub.ErrorRate(), sub.Percentile(50), sub.Percentile(90), sub.Percentile(99), sub.Succeed, sub.Count(), sub.Failed)
+	}
+}
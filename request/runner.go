@@ -0,0 +1,198 @@
+package request
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Generator generates the given number of queries.
+type Generator func(number uint) ([]Query, error)
+
+// Runner sends generated queries to the chain in intervals. Queries are
+// generated in the background ahead of sending, so the load stream is
+// continuous and generation does not count towards the measured time.
+type Runner struct {
+	generate  Generator
+	transport Transport
+	interval  time.Duration
+	// Maximum queries in flight.
+	maxInFlight int
+	// Number of batches buffered ahead of sending.
+	prefetch int
+}
+
+func NewRunner(generate Generator, transport Transport, interval time.Duration, maxInFlight int, prefetch int) *Runner {
+	if prefetch < 0 {
+		prefetch = 0
+	}
+	return &Runner{
+		generate:    generate,
+		transport:   transport,
+		interval:    interval,
+		maxInFlight: maxInFlight,
+		prefetch:    prefetch,
+	}
+}
+
+// batch is a batch of queries to send in one interval.
+type batch struct {
+	// Index of the stage the batch belongs to.
+	stage   int
+	number  uint
+	queries []Query
+	err     error
+}
+
+// pipeline generates batches for the intervals given by next in the
+// background. The returned done channel stops the generation.
+func (r *Runner) pipeline(next func() (int, uint, bool)) (<-chan batch, chan struct{}) {
+	out := make(chan batch, r.prefetch)
+	done := make(chan struct{})
+	go func() {
+		defer close(out)
+		for {
+			stage, number, ok := next()
+			if !ok {
+				return
+			}
+			b := batch{stage: stage, number: number}
+			if number > 0 {
+				b.queries, b.err = r.generate(number)
+			}
+			select {
+			case out <- b:
+			case <-done:
+				return
+			}
+			if b.err != nil {
+				return
+			}
+		}
+	}()
+	return out, done
+}
+
+// Run sends the given number of queries every interval forever, or once if
+// the interval is 0.
+func (r *Runner) Run(number uint) error {
+	first := true
+	batches, done := r.pipeline(func() (int, uint, bool) {
+		if r.interval == 0 && !first {
+			return 0, 0, false
+		}
+		first = false
+		return 0, number, true
+	})
+	defer close(done)
+	for b := range batches {
+		res, err := r.send(b)
+		if err != nil {
+			return err
+		}
+		res.Report("Performance")
+		res.ReportCategories()
+	}
+	return nil
+}
+
+// RunStage runs a stage of a load profile and returns its result.
+func (r *Runner) RunStage(stage Stage) (*Result, error) {
+	results, err := r.runStages([]Stage{stage})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// RunProfile runs all stages of a load profile and reports the
+// latency-vs-throughput curve.
+func (r *Runner) RunProfile(stages []Stage) error {
+	results, err := r.runStages(stages)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Latency-throughput curve:")
+	for i, stage := range stages {
+		if stage.Warmup {
+			continue
+		}
+		res := results[i]
+		fmt.Printf("\t%v: target %v-%v/s, achieved %.2f/s, p50 %v, p90 %v, p99 %v, succeed/total: %v/%v\n", stage.Name, stage.From, stage.To, res.Throughput(), res.Percentile(50), res.Percentile(90), res.Percentile(99), res.Succeed, res.Count())
+	}
+	return nil
+}
+
+// runStages runs the stages back to back, generating across stage
+// boundaries, and returns the result of every stage.
+func (r *Runner) runStages(stages []Stage) ([]*Result, error) {
+	if r.interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive, got %v", r.interval)
+	}
+	// Plan the number of queries of every interval.
+	type interval struct {
+		stage  int
+		number uint
+	}
+	plan := make([]interval, 0)
+	for i, stage := range stages {
+		for elapsed := time.Duration(0); elapsed < stage.Duration; elapsed += r.interval {
+			// Use the rate at the middle of the interval.
+			rate := stage.Rate(elapsed + r.interval/2)
+			plan = append(plan, interval{stage: i, number: uint(math.Round(rate * r.interval.Seconds()))})
+		}
+	}
+	next := 0
+	batches, done := r.pipeline(func() (int, uint, bool) {
+		if next >= len(plan) {
+			return 0, 0, false
+		}
+		next++
+		return plan[next-1].stage, plan[next-1].number, true
+	})
+	defer close(done)
+	results := make([]*Result, len(stages))
+	for i := range results {
+		results[i] = NewResult()
+	}
+	current := 0
+	if len(stages) > 0 {
+		fmt.Printf("Start stage %v, rate %v-%v/s, duration %v\n", stages[0].Name, stages[0].From, stages[0].To, stages[0].Duration)
+	}
+	for b := range batches {
+		for current < b.stage {
+			r.reportStage(stages[current], results[current])
+			current++
+			fmt.Printf("Start stage %v, rate %v-%v/s, duration %v\n", stages[current].Name, stages[current].From, stages[current].To, stages[current].Duration)
+		}
+		sub, err := r.send(b)
+		if err != nil {
+			return nil, err
+		}
+		if !stages[b.stage].Warmup {
+			results[b.stage].Merge(sub)
+		}
+	}
+	for ; current < len(stages); current++ {
+		r.reportStage(stages[current], results[current])
+	}
+	return results, nil
+}
+
+func (r *Runner) reportStage(stage Stage, res *Result) {
+	if !stage.Warmup {
+		res.Report(fmt.Sprintf("Stage %v", stage.Name))
+		res.ReportCategories()
+	}
+}
+
+func (r *Runner) send(b batch) (*Result, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.number == 0 {
+		time.Sleep(r.interval)
+		return NewResult(), nil
+	}
+	return Request(r.transport, b.queries, r.interval, r.maxInFlight)
+}
@@ -0,0 +1,159 @@
+package request
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// minThroughputRatio is the minimum ratio of the achieved throughput to the
+// target rate for a rate to be sustainable.
+const minThroughputRatio = 0.9
+
+// SLO is the latency and error objective a sustainable rate must meet.
+type SLO struct {
+	// Percentile in [0, 100] of the latency to check.
+	Percentile float64
+	// Latency is the maximum latency at the percentile.
+	Latency time.Duration
+	// ErrorRate is the maximum ratio of failed queries.
+	ErrorRate float64
+}
+
+// Met checks if the result of a probe at the given rate meets the objective.
+func (slo SLO) Met(rate uint, res *Result) bool {
+	if res.Count() == 0 {
+		return false
+	}
+	if res.Throughput() < minThroughputRatio*float64(rate) {
+		return false
+	}
+	return res.Percentile(slo.Percentile) <= slo.Latency && res.ErrorRate() <= slo.ErrorRate
+}
+
+// SearchConfig is the configuration of a capacity search.
+type SearchConfig struct {
+	// Mode is either bisect or aimd.
+	Mode string
+	// Min and Max bound the searched rate.
+	Min uint
+	Max uint
+	// Duration is the duration of every probe.
+	Duration time.Duration
+	// Precision stops bisection when the bounds are within it.
+	Precision uint
+	// Increase is the additive increase of aimd.
+	Increase uint
+	// Decrease is the multiplicative decrease factor of aimd.
+	Decrease float64
+	// Rounds is the number of probes of aimd.
+	Rounds int
+}
+
+type probe struct {
+	rate uint
+	res  *Result
+	met  bool
+}
+
+// Search finds the highest rate that meets the objective, and reports the
+// curve measured on the way.
+func (r *Runner) Search(cfg SearchConfig, slo SLO) (uint, error) {
+	if cfg.Min == 0 || cfg.Min > cfg.Max {
+		return 0, fmt.Errorf("invalid search bounds %v-%v", cfg.Min, cfg.Max)
+	}
+	probes := make([]probe, 0)
+	run := func(rate uint) (bool, error) {
+		fmt.Printf("Probe rate %v/s for %v\n", rate, cfg.Duration)
+		res, err := r.RunStage(Stage{
+			Name:     fmt.Sprintf("probe %v/s", rate),
+			From:     rate,
+			To:       rate,
+			Duration: cfg.Duration,
+		})
+		if err != nil {
+			return false, err
+		}
+		met := slo.Met(rate, res)
+		probes = append(probes, probe{rate: rate, res: res, met: met})
+		fmt.Printf("Probe rate %v/s met objective: %v\n", rate, met)
+		return met, nil
+	}
+	var best uint
+	var err error
+	switch cfg.Mode {
+	case "bisect":
+		best, err = bisect(cfg, run)
+	case "aimd":
+		best, err = aimd(cfg, run)
+	default:
+		return 0, fmt.Errorf("unknown search mode %v", cfg.Mode)
+	}
+	if err != nil {
+		return 0, err
+	}
+	// Report.
+	sort.SliceStable(probes, func(i, j int) bool { return probes[i].rate < probes[j].rate })
+	fmt.Printf("Measured curve for p%v <= %v, error rate <= %v:\n", slo.Percentile, slo.Latency, slo.ErrorRate)
+	for _, p := range probes {
+		fmt.Printf("\ttarget %v/s, achieved %.2f/s, p%v %v, error rate %.4f, met: %v\n", p.rate, p.res.Throughput(), slo.Percentile, p.res.Percentile(slo.Percentile), p.res.ErrorRate(), p.met)
+	}
+	fmt.Printf("Max sustainable rate: %v/s\n", best)
+	return best, nil
+}
+
+func bisect(cfg SearchConfig, run func(rate uint) (bool, error)) (uint, error) {
+	met, err := run(cfg.Min)
+	if err != nil || !met {
+		return 0, err
+	}
+	met, err = run(cfg.Max)
+	if err != nil || met {
+		return cfg.Max, err
+	}
+	precision := cfg.Precision
+	if precision == 0 {
+		precision = 1
+	}
+	lo, hi := cfg.Min, cfg.Max
+	for hi-lo > precision {
+		mid := lo + (hi-lo)/2
+		met, err = run(mid)
+		if err != nil {
+			return 0, err
+		}
+		if met {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+func aimd(cfg SearchConfig, run func(rate uint) (bool, error)) (uint, error) {
+	if cfg.Increase == 0 || cfg.Decrease <= 0 || cfg.Decrease >= 1 {
+		return 0, fmt.Errorf("invalid aimd increase %v and decrease %v", cfg.Increase, cfg.Decrease)
+	}
+	best := uint(0)
+	rate := cfg.Min
+	for i := 0; i < cfg.Rounds; i++ {
+		met, err := run(rate)
+		if err != nil {
+			return 0, err
+		}
+		if met {
+			if rate > best {
+				best = rate
+			}
+			rate += cfg.Increase
+			if rate > cfg.Max {
+				rate = cfg.Max
+			}
+		} else {
+			rate = uint(math.Max(float64(cfg.Min), float64(rate)*cfg.Decrease))
+		}
+	}
+	return best, nil
+}
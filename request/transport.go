@@ -0,0 +1,169 @@
+package request
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Transport sends queries to the chain access point.
+type Transport interface {
+	// Prepare gets the query ready to be sent, so the work is not part of
+	// the measured latency.
+	Prepare(query string) (Prepared, error)
+
+	// Send sends a prepared query and blocks until its response arrives.
+	// It returns true if the query succeeded.
+	Send(query Prepared) (bool, error)
+
+	// Close closes all connections held by the transport.
+	Close() error
+}
+
+// Prepared is a query ready to be sent by a transport.
+type Prepared struct {
+	// Body to send
+	body []byte
+	// Id of the body, set by multiplexed transports
+	id string
+}
+
+// TransportConfig is the configuration of a transport.
+type TransportConfig struct {
+	// KeepAlive reuses HTTP connections between queries.
+	KeepAlive bool
+	// MaxConns is the size of the HTTP/1.1 connection pool, 0 means
+	// unlimited.
+	MaxConns int
+	// HTTP2 forces HTTP/2, using h2c for plain http endpoints.
+	HTTP2 bool
+	// Conns is the number of persistent WebSocket or IPC connections.
+	Conns int
+	// Timeout is the deadline of every query, 0 means none.
+	Timeout time.Duration
+}
+
+// NewTransport creates a transport based on the scheme of the access point:
+// http(s) for HTTP, ws(s) for WebSocket and a file path for IPC.
+func NewTransport(ap string, cfg TransportConfig) (Transport, error) {
+	u, err := url.Parse(ap)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if cfg.HTTP2 && cfg.MaxConns > 0 {
+			// HTTP/2 multiplexes queries over a connection per host.
+			return nil, fmt.Errorf("connection pool size is not supported with http/2")
+		}
+		return newHTTPTransport(ap, cfg), nil
+	case "ws", "wss":
+		return newMuxTransport(cfg.Conns, cfg.Timeout, func() (codec, error) {
+			return dialWS(ap)
+		})
+	case "", "unix", "ipc":
+		path := u.Path
+		if u.Scheme == "" {
+			path = ap
+		}
+		return newMuxTransport(cfg.Conns, cfg.Timeout, func() (codec, error) {
+			return dialIPC(path)
+		})
+	default:
+		return nil, fmt.Errorf("unsupported access point scheme %v", u.Scheme)
+	}
+}
+
+// Idle connections kept by an unlimited HTTP pool
+const unlimitedIdleConns = 4096
+
+type httpTransport struct {
+	url       string
+	keepAlive bool
+	client    *http.Client
+}
+
+func newHTTPTransport(url string, cfg TransportConfig) *httpTransport {
+	var rt http.RoundTripper
+	if cfg.HTTP2 {
+		plain := strings.HasPrefix(url, "http://")
+		rt = &http2.Transport{
+			// Allow h2c for plain http endpoints.
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, tlsCfg *tls.Config) (net.Conn, error) {
+				if plain {
+					return net.Dial(network, addr)
+				}
+				return tls.Dial(network, addr, tlsCfg)
+			},
+		}
+	} else {
+		// An unlimited pool keeps every connection idle between queries, as
+		// the default of 2 idle connections per host would close and redial
+		// the others.
+		idleConns := cfg.MaxConns
+		if idleConns == 0 {
+			idleConns = unlimitedIdleConns
+		}
+		rt = &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DisableKeepAlives:   !cfg.KeepAlive,
+			MaxIdleConns:        idleConns,
+			MaxIdleConnsPerHost: idleConns,
+			MaxConnsPerHost:     cfg.MaxConns,
+			IdleConnTimeout:     90 * time.Second,
+		}
+	}
+	return &httpTransport{
+		url:       url,
+		keepAlive: cfg.KeepAlive,
+		client:    &http.Client{Transport: rt, Timeout: cfg.Timeout},
+	}
+}
+
+func (t *httpTransport) Prepare(query string) (Prepared, error) {
+	return Prepared{body: []byte(query)}, nil
+}
+
+func (t *httpTransport) Send(query Prepared) (bool, error) {
+	req, err := http.NewRequest("POST", t.url, bytes.NewReader(query.body))
+	if err != nil {
+		return false, err
+	}
+	req.Close = !t.keepAlive
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	// Read the whole body so the connection can be reused.
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode != 200 {
+		return false, nil
+	}
+	// A JSON-RPC error is a failure, as over WebSocket and IPC.
+	msg := message{}
+	err = json.Unmarshal(data, &msg)
+	if err != nil {
+		return false, fmt.Errorf("fail to decode response: %v", err.Error())
+	}
+	return msg.succeeded(), nil
+}
+
+func (t *httpTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
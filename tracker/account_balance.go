@@ -0,0 +1,116 @@
+package tracker
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/wcgcyx/ethgen/idgen"
+)
+
+// Template of eth_getBalance
+var balanceTpl = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getBalance","params":["0x$", $]}`)
+
+type AccountBalanceTracker struct {
+	// Id generator
+	idGen idgen.IdGenerator
+	// Configuration
+	maxBlocks  uint
+	maxEntries uint
+	// State, an immutable *accountBalanceState swapped after every block
+	state atomic.Value
+}
+
+type accountBalanceState struct {
+	// State of the method
+	accessed window
+	// State of the account list
+	accounts keyList
+	// Current block and its parent hash
+	blk        uint64
+	parentHash common.Hash
+}
+
+func NewAccountBalanceTracker(idGen idgen.IdGenerator, maxBlocks uint, maxEntries uint) *AccountBalanceTracker {
+	t := &AccountBalanceTracker{
+		idGen:      idGen,
+		maxBlocks:  maxBlocks,
+		maxEntries: maxEntries,
+	}
+	t.state.Store(&accountBalanceState{
+		accounts: newKeyList(common.AddressLength),
+	})
+	return t
+}
+
+func (t *AccountBalanceTracker) load() *accountBalanceState {
+	return t.state.Load().(*accountBalanceState)
+}
+
+func (t *AccountBalanceTracker) ApplyBlock(blk *Block) error {
+	accessed := uint(0)
+	accountsToAdd := make([]byte, 0)
+	// Apply block
+	for _, tx := range blk.Txs {
+		if tx.To == "" || tx.Transaction.Value().Sign() == 0 {
+			continue
+		}
+		// Native value transfer
+		accountsToAdd = append(append(accountsToAdd, tx.Recipient[:]...), tx.From[:]...)
+		// Method accessed once
+		accessed++
+	}
+	s := t.load()
+	next := &accountBalanceState{
+		blk:        blk.Number,
+		parentHash: blk.ParentHash,
+	}
+	// Update method state
+	next.accessed, _ = s.accessed.push(blk.Number, accessed, t.maxBlocks)
+	// Update accounts state
+	next.accounts = s.accounts.push(blk.Number, accountsToAdd, t.maxBlocks, t.maxEntries)
+	t.state.Store(next)
+	return nil
+}
+
+func (t *AccountBalanceTracker) CurrentWeight() uint {
+	return t.load().accessed.total
+}
+
+func (t *AccountBalanceTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	s := t.load()
+	if s.accounts.len() == 0 {
+		return nil, fmt.Errorf("empty accounts")
+	}
+	selector, err := newBlockSelector(opts, accountTags)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Query, number)
+	e := newEncoder()
+	for i := uint(0); i < number; i++ {
+		account := s.accounts.random()
+		res[i] = Query{
+			Kind:     "account",
+			Tracker:  "account_balance",
+			Contract: "",
+			Method:   "eth_getBalance",
+		}
+		e.start(balanceTpl, t.idGen.Next())
+		e.hex(account)
+		selector.encode(e, s.blk, s.parentHash)
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
+	}
+	return res, nil
+}
+
+func (t *AccountBalanceTracker) Memory() uint64 {
+	return t.load().accounts.bytes
+}
+
+func (t *AccountBalanceTracker) Status() string {
+	return fmt.Sprintf("%v", t.CurrentWeight())
+}
@@ -0,0 +1,112 @@
+package tracker
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/wcgcyx/ethgen/idgen"
+)
+
+// Template of eth_getTransactionCount
+var nonceTpl = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getTransactionCount","params":["0x$", $]}`)
+
+type AccountNonceTracker struct {
+	// Id generator
+	idGen idgen.IdGenerator
+	// Configuration
+	maxBlocks  uint
+	maxEntries uint
+	// State, an immutable *accountNonceState swapped after every block
+	state atomic.Value
+}
+
+type accountNonceState struct {
+	// State of the method
+	accessed window
+	// State of the account list
+	accounts keyList
+	// Current block and its parent hash
+	blk        uint64
+	parentHash common.Hash
+}
+
+func NewAccountNonceTracker(idGen idgen.IdGenerator, maxBlocks uint, maxEntries uint) *AccountNonceTracker {
+	t := &AccountNonceTracker{
+		idGen:      idGen,
+		maxBlocks:  maxBlocks,
+		maxEntries: maxEntries,
+	}
+	t.state.Store(&accountNonceState{
+		accounts: newKeyList(common.AddressLength),
+	})
+	return t
+}
+
+func (t *AccountNonceTracker) load() *accountNonceState {
+	return t.state.Load().(*accountNonceState)
+}
+
+func (t *AccountNonceTracker) ApplyBlock(blk *Block) error {
+	accessed := uint(0)
+	accountsToAdd := make([]byte, 0)
+	// Apply block
+	for _, tx := range blk.Txs {
+		accountsToAdd = append(accountsToAdd, tx.From[:]...)
+		// Method accessed once
+		accessed++
+	}
+	s := t.load()
+	next := &accountNonceState{
+		blk:        blk.Number,
+		parentHash: blk.ParentHash,
+	}
+	// Update method state
+	next.accessed, _ = s.accessed.push(blk.Number, accessed, t.maxBlocks)
+	// Update accounts state
+	next.accounts = s.accounts.push(blk.Number, accountsToAdd, t.maxBlocks, t.maxEntries)
+	t.state.Store(next)
+	return nil
+}
+
+func (t *AccountNonceTracker) CurrentWeight() uint {
+	return t.load().accessed.total
+}
+
+func (t *AccountNonceTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	s := t.load()
+	if s.accounts.len() == 0 {
+		return nil, fmt.Errorf("empty accounts")
+	}
+	selector, err := newBlockSelector(opts, accountTags)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Query, number)
+	e := newEncoder()
+	for i := uint(0); i < number; i++ {
+		account := s.accounts.random()
+		res[i] = Query{
+			Kind:     "account",
+			Tracker:  "account_nonce",
+			Contract: "",
+			Method:   "eth_getTransactionCount",
+		}
+		e.start(nonceTpl, t.idGen.Next())
+		e.hex(account)
+		selector.encode(e, s.blk, s.parentHash)
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
+	}
+	return res, nil
+}
+
+func (t *AccountNonceTracker) Memory() uint64 {
+	return t.load().accounts.bytes
+}
+
+func (t *AccountNonceTracker) Status() string {
+	return fmt.Sprintf("%v", t.CurrentWeight())
+}
@@ -2,45 +2,93 @@ package tracker
 
 import (
 	"fmt"
+	"math/big"
+	"strings"
 	"sync"
 
-	"github.com/wcgcyx/ethgen/idgen"
-	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/common"
 	wr "github.com/mroth/weightedrand"
+	"github.com/wcgcyx/ethgen/idgen"
 )
 
 type BatchTracker struct {
-	weight uint
 	// Sub-trackers
 	trackers []Tracker
+	// Sub-trackers by the contract they follow, nil if every sub-tracker
+	// applies every block, the window and the latest block
+	routes    map[string][]Tracker
+	maxBlocks uint
+	head      *Head
+	// Blocks in the window calling any contract, oldest first
+	called []calledBlock
+}
+
+// calledBlock is a block and the sub-trackers of the contracts it calls.
+type calledBlock struct {
+	number   uint64
+	trackers []Tracker
 }
 
 func NewBatchTracker(trackers []Tracker) *BatchTracker {
 	return &BatchTracker{
-		weight:   0,
 		trackers: trackers,
 	}
 }
 
-func NewERC20BatchTracker(idGen idgen.IdGenerator, contractAddrs []string, maxBlocks uint) *BatchTracker {
-	trackers := make([]Tracker, 0)
-	for _, contractAddr := range contractAddrs {
-		trackers = append(trackers, NewERC20ContractTracker(idGen, contractAddr, maxBlocks))
-	}
+// newContractBatchTracker creates a batch routing every block only to the
+// trackers of the contracts it calls.
+func newContractBatchTracker(maxBlocks uint, head *Head) *BatchTracker {
 	return &BatchTracker{
-		weight:   0,
-		trackers: trackers,
+		trackers:  make([]Tracker, 0),
+		routes:    make(map[string][]Tracker),
+		maxBlocks: maxBlocks,
+		head:      head,
+		called:    make([]calledBlock, 0),
 	}
 }
 
-func NewERC721BatchTracker(idGen idgen.IdGenerator, contractAddrs []string, maxBlocks uint) *BatchTracker {
-	trackers := make([]Tracker, 0)
+// route adds the tracker of a contract.
+func (t *BatchTracker) route(contractAddr string, tracker Tracker) {
+	contractAddr = strings.ToLower(contractAddr)
+	t.trackers = append(t.trackers, tracker)
+	t.routes[contractAddr] = append(t.routes[contractAddr], tracker)
+}
+
+// NewERC20BatchTracker creates the trackers of ERC20 contracts, given the
+// slots of their balance mappings by contract, contracts without a slot not
+// having their balances overridden.
+func NewERC20BatchTracker(idGen idgen.IdGenerator, contractAddrs []string, maxBlocks uint, maxEntries uint, snapshot map[string][]string, balanceSlots map[string]uint64) *BatchTracker {
+	slots := make(map[string]common.Hash)
+	for contractAddr, slot := range balanceSlots {
+		slots[normaliseAddress(contractAddr)] = common.BigToHash(new(big.Int).SetUint64(slot))
+	}
+	head := NewHead()
+	t := newContractBatchTracker(maxBlocks, head)
+	for _, contractAddr := range contractAddrs {
+		var balanceSlot *common.Hash
+		if slot, ok := slots[normaliseAddress(contractAddr)]; ok {
+			balanceSlot = &slot
+		}
+		t.route(contractAddr, NewERC20ContractTracker(idGen, head, contractAddr, maxBlocks, maxEntries, snapshot[normaliseAddress(contractAddr)], balanceSlot))
+	}
+	return t
+}
+
+func NewERC721BatchTracker(idGen idgen.IdGenerator, contractAddrs []string, maxBlocks uint, maxEntries uint, snapshot map[string][]string) *BatchTracker {
+	head := NewHead()
+	t := newContractBatchTracker(maxBlocks, head)
 	for _, contractAddr := range contractAddrs {
-		trackers = append(trackers, NewERC721ContractTracker(idGen, contractAddr, maxBlocks))
+		t.route(contractAddr, NewERC721ContractTracker(idGen, head, contractAddr, maxBlocks, maxEntries, snapshot[normaliseAddress(contractAddr)]))
 	}
+	return t
+}
+
+func NewAccountBatchTracker(idGen idgen.IdGenerator, maxBlocks uint, maxEntries uint) *BatchTracker {
 	return &BatchTracker{
-		weight:   0,
-		trackers: trackers,
+		trackers: []Tracker{
+			NewAccountBalanceTracker(idGen, maxBlocks, maxEntries),
+			NewAccountNonceTracker(idGen, maxBlocks, maxEntries),
+		},
 	}
 }
 
@@ -48,7 +96,11 @@ func (t *BatchTracker) Trackers() []Tracker {
 	return t.trackers
 }
 
-func (t *BatchTracker) ApplyBlock(blk *types.Block) error {
+func (t *BatchTracker) ApplyBlock(blk *Block) error {
+	if t.routes != nil {
+		t.applyRouted(blk)
+		return nil
+	}
 	wg := sync.WaitGroup{}
 	for _, tracker := range t.trackers {
 		wg.Add(1)
@@ -61,18 +113,48 @@ func (t *BatchTracker) ApplyBlock(blk *types.Block) error {
 		}(tracker)
 	}
 	wg.Wait()
-	t.weight = 0
-	for _, tracker := range t.trackers {
-		t.weight += tracker.CurrentWeight()
-	}
 	return nil
 }
 
+// applyRouted applies a block to the trackers of the contracts it calls, and
+// to the trackers of the contracts called by the block leaving the window,
+// so every window stays exact while other trackers are skipped.
+func (t *BatchTracker) applyRouted(blk *Block) {
+	t.head.set(blk)
+	called := calledBlock{number: blk.Number}
+	for to := range blk.byTo {
+		called.trackers = append(called.trackers, t.routes[to]...)
+	}
+	trackers := called.trackers
+	for len(t.called) > 0 && t.called[0].number+uint64(t.maxBlocks) <= blk.Number {
+		trackers = append(trackers[:len(trackers):len(trackers)], t.called[0].trackers...)
+		t.called = t.called[1:]
+	}
+	if len(called.trackers) > 0 {
+		t.called = append(t.called, called)
+	}
+	applied := make(map[Tracker]bool, len(trackers))
+	for _, tracker := range trackers {
+		if applied[tracker] {
+			continue
+		}
+		applied[tracker] = true
+		err := tracker.ApplyBlock(blk)
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+}
+
 func (t *BatchTracker) CurrentWeight() uint {
-	return t.weight
+	weight := uint(0)
+	for _, tracker := range t.trackers {
+		weight += tracker.CurrentWeight()
+	}
+	return weight
 }
 
-func (t *BatchTracker) GenerateQuery(number uint) ([]string, error) {
+func (t *BatchTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
 	counts := make([]uint, len(t.trackers))
 	choices := make([]wr.Choice, 0)
 	for index, tracker := range t.trackers {
@@ -86,14 +168,14 @@ func (t *BatchTracker) GenerateQuery(number uint) ([]string, error) {
 		contract := contractChooser.Pick().(int)
 		counts[contract]++
 	}
-	resList := make([][]string, len(t.trackers))
+	resList := make([][]Query, len(t.trackers))
 	wg := sync.WaitGroup{}
 	for index, tracker := range t.trackers {
 		wg.Add(1)
 		go func(index int, tracker Tracker) {
 			defer wg.Done()
 			count := counts[index]
-			res, err := tracker.GenerateQuery(count)
+			res, err := tracker.GenerateQuery(count, opts)
 			if err != nil {
 				fmt.Println(err.Error())
 			} else {
@@ -102,15 +184,23 @@ func (t *BatchTracker) GenerateQuery(number uint) ([]string, error) {
 		}(index, tracker)
 	}
 	wg.Wait()
-	res := make([]string, 0)
+	res := make([]Query, 0)
 	for _, sub := range resList {
 		res = append(res, sub...)
 	}
 	return res, nil
 }
 
+func (t *BatchTracker) Memory() uint64 {
+	memory := uint64(0)
+	for _, tracker := range t.trackers {
+		memory += tracker.Memory()
+	}
+	return memory
+}
+
 func (t *BatchTracker) Status() string {
-	res := fmt.Sprintf("%v - ", t.weight)
+	res := fmt.Sprintf("%v - ", t.CurrentWeight())
 	for _, tracker := range t.trackers {
 		res += tracker.Status() + " "
 	}
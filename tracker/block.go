@@ -0,0 +1,153 @@
+package tracker
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/wcgcyx/ethgen/idgen"
+)
+
+// BlockMethods are the block methods, eth_getBlockByNumber without and with
+// full transactions, eth_getBlockByHash, eth_getBlockTransactionCountByNumber,
+// eth_getUncleCountByBlockHash and eth_blockNumber.
+var BlockMethods = []string{"number", "number_full", "hash", "tx_count", "uncle_count", "block_number"}
+
+var (
+	// Templates of block methods
+	blockByNumberTpl = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getBlockByNumber","params":["$",$]}`)
+	blockByHashTpl   = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getBlockByHash","params":["0x$",false]}`)
+	txCountTpl       = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getBlockTransactionCountByNumber","params":["$"]}`)
+	uncleCountTpl    = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getUncleCountByBlockHash","params":["0x$"]}`)
+	blockNumberTpl   = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_blockNumber","params":[]}`)
+)
+
+type BlockTracker struct {
+	// Id generator
+	idGen idgen.IdGenerator
+	// Configuration
+	maxBlocks uint
+	methods   map[string]uint
+	// Recency skew, the block at index len*u^skew from the newest is
+	// picked for a uniform u, 1 for uniform over the window
+	skew float64
+	// State of the block list, oldest first, an immutable []blockEntry
+	// swapped after every block
+	blocksFlat atomic.Value
+}
+
+type blockEntry struct {
+	number uint64
+	hash   common.Hash
+}
+
+func NewBlockTracker(idGen idgen.IdGenerator, maxBlocks uint, methods map[string]uint, skew float64) *BlockTracker {
+	t := &BlockTracker{
+		idGen:     idGen,
+		maxBlocks: maxBlocks,
+		methods:   methods,
+		skew:      skew,
+	}
+	t.blocksFlat.Store(make([]blockEntry, 0))
+	return t
+}
+
+// blocks gets the blocks of the current snapshot, oldest first.
+func (t *BlockTracker) blocks() []blockEntry {
+	return t.blocksFlat.Load().([]blockEntry)
+}
+
+func (t *BlockTracker) ApplyBlock(blk *Block) error {
+	if blk.Number == 0 {
+		return nil
+	}
+	// The parent hash is taken from the block, as the hash computed from
+	// a header with fields unknown to the client can be wrong.
+	blocks := t.blocks()
+	if uint(len(blocks)) >= t.maxBlocks {
+		blocks = blocks[1:]
+	}
+	t.blocksFlat.Store(append(blocks, blockEntry{
+		number: blk.Number - 1,
+		hash:   blk.ParentHash,
+	}))
+	return nil
+}
+
+func (t *BlockTracker) CurrentWeight() uint {
+	return uint(len(t.blocks()))
+}
+
+func (t *BlockTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	blocks := t.blocks()
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("empty blocks")
+	}
+	methodChooser, err := newWeightedChooser(t.methods)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Query, number)
+	e := newEncoder()
+	for i := uint(0); i < number; i++ {
+		blk := t.pick(blocks)
+		res[i] = Query{
+			Kind:     "block",
+			Tracker:  "block",
+			Contract: "",
+		}
+		switch methodChooser.Pick().(string) {
+		case "number":
+			res[i].Method = "eth_getBlockByNumber"
+			e.start(blockByNumberTpl, t.idGen.Next())
+			e.quantity(blk.number)
+			e.str("false")
+		case "number_full":
+			res[i].Method = "eth_getBlockByNumber:full"
+			e.start(blockByNumberTpl, t.idGen.Next())
+			e.quantity(blk.number)
+			e.str("true")
+		case "hash":
+			res[i].Method = "eth_getBlockByHash"
+			e.start(blockByHashTpl, t.idGen.Next())
+			e.hex(blk.hash[:])
+		case "tx_count":
+			res[i].Method = "eth_getBlockTransactionCountByNumber"
+			e.start(txCountTpl, t.idGen.Next())
+			e.quantity(blk.number)
+		case "uncle_count":
+			res[i].Method = "eth_getUncleCountByBlockHash"
+			e.start(uncleCountTpl, t.idGen.Next())
+			e.hex(blk.hash[:])
+		default:
+			res[i].Method = "eth_blockNumber"
+			e.start(blockNumberTpl, t.idGen.Next())
+		}
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
+	}
+	return res, nil
+}
+
+// pick picks a block in a snapshot of the window, skewed towards recent
+// blocks.
+func (t *BlockTracker) pick(blocks []blockEntry) blockEntry {
+	index := int(float64(len(blocks)) * math.Pow(rand.Float64(), t.skew))
+	if index >= len(blocks) {
+		index = len(blocks) - 1
+	}
+	return blocks[len(blocks)-1-index]
+}
+
+func (t *BlockTracker) Memory() uint64 {
+	return uint64(cap(t.blocks())) * uint64(unsafe.Sizeof(blockEntry{}))
+}
+
+func (t *BlockTracker) Status() string {
+	return fmt.Sprintf("%v", t.CurrentWeight())
+}
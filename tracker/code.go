@@ -0,0 +1,128 @@
+package tracker
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/wcgcyx/ethgen/idgen"
+)
+
+// Template of eth_getCode
+var codeTpl = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getCode","params":["0x$",$]}`)
+
+type CodeTracker struct {
+	// Id generator
+	idGen idgen.IdGenerator
+	// Configuration
+	maxBlocks  uint
+	maxEntries uint
+	// State, an immutable *codeState swapped after every block
+	state atomic.Value
+}
+
+type codeState struct {
+	// State of the method
+	accessed window
+	// State of the contract list
+	contracts keyList
+	// Current block and its parent hash
+	blk        uint64
+	parentHash common.Hash
+}
+
+func NewCodeTracker(idGen idgen.IdGenerator, maxBlocks uint, maxEntries uint) *CodeTracker {
+	t := &CodeTracker{
+		idGen:      idGen,
+		maxBlocks:  maxBlocks,
+		maxEntries: maxEntries,
+	}
+	t.state.Store(&codeState{
+		contracts: newKeyList(common.AddressLength),
+	})
+	return t
+}
+
+func (t *CodeTracker) load() *codeState {
+	return t.state.Load().(*codeState)
+}
+
+func (t *CodeTracker) ApplyBlock(blk *Block) error {
+	accessed := uint(0)
+	contractsToAdd := make([]byte, 0)
+	seen := make(map[common.Address]bool)
+	// Apply block
+	for _, tx := range blk.Txs {
+		var contract common.Address
+		if tx.To == "" {
+			// Contract creation
+			contract = crypto.CreateAddress(tx.From, tx.Transaction.Nonce())
+		} else if len(tx.Transaction.Data()) > 0 {
+			// Contract call
+			contract = tx.Recipient
+		} else {
+			continue
+		}
+		if seen[contract] {
+			continue
+		}
+		seen[contract] = true
+		contractsToAdd = append(contractsToAdd, contract[:]...)
+		// Method accessed once
+		accessed++
+	}
+	s := t.load()
+	next := &codeState{
+		blk:        blk.Number,
+		parentHash: blk.ParentHash,
+	}
+	// Update method state
+	next.accessed, _ = s.accessed.push(blk.Number, accessed, t.maxBlocks)
+	// Update contracts state
+	next.contracts = s.contracts.push(blk.Number, contractsToAdd, t.maxBlocks, t.maxEntries)
+	t.state.Store(next)
+	return nil
+}
+
+func (t *CodeTracker) CurrentWeight() uint {
+	return t.load().accessed.total
+}
+
+func (t *CodeTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	s := t.load()
+	if s.contracts.len() == 0 {
+		return nil, fmt.Errorf("empty contracts")
+	}
+	selector, err := newBlockSelector(opts, accountTags)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Query, number)
+	e := newEncoder()
+	for i := uint(0); i < number; i++ {
+		contract := s.contracts.random()
+		res[i] = Query{
+			Kind:     "code",
+			Tracker:  "code",
+			Contract: contractName(common.BytesToAddress(contract)),
+			Method:   "eth_getCode",
+		}
+		e.start(codeTpl, t.idGen.Next())
+		e.hex(contract)
+		selector.encode(e, s.blk, s.parentHash)
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
+	}
+	return res, nil
+}
+
+func (t *CodeTracker) Memory() uint64 {
+	return t.load().contracts.bytes
+}
+
+func (t *CodeTracker) Status() string {
+	return fmt.Sprintf("%v", t.CurrentWeight())
+}
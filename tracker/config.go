@@ -0,0 +1,50 @@
+package tracker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	wr "github.com/mroth/weightedrand"
+)
+
+// ParseWeights parses a comma separated list of name:weight pairs, only
+// accepting the given names.
+func ParseWeights(spec string, names ...string) (map[string]uint, error) {
+	res := make(map[string]uint)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		fields := strings.Split(item, ":")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("fail to parse %v: expect name:weight", item)
+		}
+		known := false
+		for _, name := range names {
+			if name == fields[0] {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("fail to parse %v: unknown name %v, expect one of %v", item, fields[0], names)
+		}
+		weight, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse %v: %v", item, err.Error())
+		}
+		res[fields[0]] = uint(weight)
+	}
+	return res, nil
+}
+
+// newWeightedChooser creates a chooser picking names by weights.
+func newWeightedChooser(weights map[string]uint) (*wr.Chooser, error) {
+	choices := make([]wr.Choice, 0)
+	for name, weight := range weights {
+		choices = append(choices, wr.NewChoice(name, weight))
+	}
+	return wr.NewChooser(choices...)
+}
@@ -0,0 +1,125 @@
+package tracker
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// template is a precompiled json rpc request, the static parts around the
+// holes filled per query, the first hole being the id.
+type template []string
+
+// compile compiles a request with the holes marked by $, which is never
+// part of a generated request.
+func compile(format string) template {
+	return strings.Split(format, "$")
+}
+
+// encoder encodes the queries of a batch into a pooled buffer. The bodies of
+// the batch are converted to a single string and sliced, so encoding costs
+// no allocation per query.
+type encoder struct {
+	buf []byte
+	// End offsets of the encoded bodies
+	ends []int
+	// Template of the current body and its next part
+	tpl  template
+	part int
+}
+
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		return &encoder{
+			buf:  make([]byte, 0, 64*1024),
+			ends: make([]int, 0, 256),
+		}
+	},
+}
+
+// newEncoder gets an encoder from the pool.
+func newEncoder() *encoder {
+	e := encoderPool.Get().(*encoder)
+	e.buf = e.buf[:0]
+	e.ends = e.ends[:0]
+	return e
+}
+
+// start starts a body by the template, with the given id.
+func (e *encoder) start(tpl template, id int64) {
+	e.tpl = tpl
+	e.buf = append(e.buf, tpl[0]...)
+	e.buf = strconv.AppendInt(e.buf, id, 10)
+	e.buf = append(e.buf, tpl[1]...)
+	e.part = 2
+}
+
+// next appends the static part following a hole.
+func (e *encoder) next() {
+	e.buf = append(e.buf, e.tpl[e.part]...)
+	e.part++
+}
+
+// hex fills a hole with the lowercase hex of the bytes, without 0x.
+func (e *encoder) hex(b []byte) {
+	e.appendHex(b)
+	e.next()
+}
+
+// str fills a hole with the string.
+func (e *encoder) str(s string) {
+	e.buf = append(e.buf, s...)
+	e.next()
+}
+
+// quantity fills a hole with the hex quantity of the number, with 0x.
+func (e *encoder) quantity(n uint64) {
+	e.appendQuantity(n)
+	e.next()
+}
+
+// finish ends the body.
+func (e *encoder) finish() {
+	e.ends = append(e.ends, len(e.buf))
+}
+
+func (e *encoder) appendHex(b []byte) {
+	const digits = "0123456789abcdef"
+	for _, v := range b {
+		e.buf = append(e.buf, digits[v>>4], digits[v&0x0f])
+	}
+}
+
+// appendQuoted appends the quoted hex of the bytes, with 0x.
+func (e *encoder) appendQuoted(b []byte) {
+	e.buf = append(e.buf, `"0x`...)
+	e.appendHex(b)
+	e.buf = append(e.buf, '"')
+}
+
+func (e *encoder) appendQuantity(n uint64) {
+	e.buf = append(e.buf, "0x"...)
+	e.buf = strconv.AppendUint(e.buf, n, 16)
+}
+
+// bodies gets the encoded bodies and returns the encoder to the pool.
+func (e *encoder) bodies() []string {
+	all := string(e.buf)
+	res := make([]string, len(e.ends))
+	start := 0
+	for i, end := range e.ends {
+		res[i] = all[start:end]
+		start = end
+	}
+	encoderPool.Put(e)
+	return res
+}
+
+// contractName gets the name of a contract in categories, lowercase hex
+// without 0x.
+func contractName(addr common.Address) string {
+	return hex.EncodeToString(addr[:])
+}
@@ -4,9 +4,10 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/wcgcyx/ethgen/idgen"
-	"github.com/ethereum/go-ethereum/core/types"
 
 	wr "github.com/mroth/weightedrand"
 )
@@ -15,23 +16,25 @@ type ERC20ContractTracker struct {
 	// Configuration
 	contractAddr string
 	maxBlocks    uint
-	// Contract state
-	weight   uint
-	accessed []uint
+	// Contract state, a window swapped after every block
+	accessed atomic.Value
+	// Latest block, shared by the batch
+	head *Head
 	// Sub-trackers
 	balTracker Tracker
 	apvTracker Tracker
 }
 
-func NewERC20ContractTracker(idGen idgen.IdGenerator, contractAddr string, maxBlocks uint) *ERC20ContractTracker {
-	return &ERC20ContractTracker{
+func NewERC20ContractTracker(idGen idgen.IdGenerator, head *Head, contractAddr string, maxBlocks uint, maxEntries uint, snapshot []string, balanceSlot *common.Hash) *ERC20ContractTracker {
+	t := &ERC20ContractTracker{
 		contractAddr: strings.ToLower(contractAddr),
 		maxBlocks:    maxBlocks,
-		weight:       0,
-		accessed:     make([]uint, maxBlocks),
-		balTracker:   NewERC20BalanceTracker(idGen, contractAddr, maxBlocks),
-		apvTracker:   NewERC20ApprovalTracker(idGen, contractAddr, maxBlocks),
+		head:         head,
+		balTracker:   NewERC20BalanceTracker(idGen, head, contractAddr, maxBlocks, maxEntries, snapshot, balanceSlot),
+		apvTracker:   NewERC20ApprovalTracker(idGen, head, contractAddr, maxBlocks, maxEntries),
 	}
+	t.accessed.Store(window{})
+	return t
 }
 
 func (t *ERC20ContractTracker) Bal() Tracker {
@@ -42,54 +45,29 @@ func (t *ERC20ContractTracker) Apv() Tracker {
 	return t.apvTracker
 }
 
-func (t *ERC20ContractTracker) ApplyBlock(blk *types.Block) error {
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		err := t.balTracker.ApplyBlock(blk)
-		if err != nil {
-			fmt.Println(err.Error())
-		}
-	}()
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		err := t.apvTracker.ApplyBlock(blk)
-		if err != nil {
-			fmt.Println(err.Error())
-		}
-	}()
-	accessed := uint(0)
-	// Apply block
-	for i := 0; i < blk.Transactions().Len(); i++ {
-		tx := blk.Transactions()[i]
-		if tx.To() == nil {
-			continue
-		}
-		to := strings.ToLower(tx.To().String()[2:])
-		if to == t.contractAddr {
-			// Contract accessed once
-			accessed++
-		}
+func (t *ERC20ContractTracker) ApplyBlock(blk *Block) error {
+	t.head.set(blk)
+	err := t.balTracker.ApplyBlock(blk)
+	if err != nil {
+		return err
 	}
+	err = t.apvTracker.ApplyBlock(blk)
+	if err != nil {
+		return err
+	}
+	// Contract accessed once per call
+	accessed := uint(len(blk.Calls(t.contractAddr)))
 	// Update method state
-	// Pop
-	pop1 := t.accessed[t.maxBlocks-1]
-	t.weight -= pop1
-	t.accessed = t.accessed[:t.maxBlocks-1]
-	// Push
-	t.weight += accessed
-	t.accessed = append([]uint{accessed}, t.accessed...)
-	wg.Wait()
+	next, _ := t.accessed.Load().(window).push(blk.Number, accessed, t.maxBlocks)
+	t.accessed.Store(next)
 	return nil
 }
 
 func (t *ERC20ContractTracker) CurrentWeight() uint {
-	return t.weight
+	return t.accessed.Load().(window).total
 }
 
-func (t *ERC20ContractTracker) GenerateQuery(number uint) ([]string, error) {
+func (t *ERC20ContractTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
 	contractChooser, err := wr.NewChooser(
 		wr.NewChoice(1, t.balTracker.CurrentWeight()),
 		wr.NewChoice(2, t.apvTracker.CurrentWeight()),
@@ -107,14 +85,14 @@ func (t *ERC20ContractTracker) GenerateQuery(number uint) ([]string, error) {
 			apv++
 		}
 	}
-	var res1 []string
-	var res2 []string
+	var res1 []Query
+	var res2 []Query
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		var err error
-		res1, err = t.balTracker.GenerateQuery(bal)
+		res1, err = t.balTracker.GenerateQuery(bal, opts)
 		if err != nil {
 			fmt.Println(err.Error())
 		}
@@ -123,7 +101,7 @@ func (t *ERC20ContractTracker) GenerateQuery(number uint) ([]string, error) {
 	go func() {
 		defer wg.Done()
 		var err error
-		res2, err = t.apvTracker.GenerateQuery(apv)
+		res2, err = t.apvTracker.GenerateQuery(apv, opts)
 		if err != nil {
 			fmt.Println(err.Error())
 		}
@@ -132,6 +110,10 @@ func (t *ERC20ContractTracker) GenerateQuery(number uint) ([]string, error) {
 	return append(res1, res2...), nil
 }
 
+func (t *ERC20ContractTracker) Memory() uint64 {
+	return t.balTracker.Memory() + t.apvTracker.Memory()
+}
+
 func (t *ERC20ContractTracker) Status() string {
 	return fmt.Sprintf("(%v-%v)", t.balTracker.CurrentWeight(), t.apvTracker.CurrentWeight())
 }
@@ -1,114 +1,121 @@
 package tracker
 
 import (
-	"encoding/hex"
 	"fmt"
-	"math/big"
-	"math/rand"
 	"strings"
+	"sync/atomic"
 
-	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/wcgcyx/ethgen/idgen"
 )
 
 type ERC20ApprovalTracker struct {
 	// Id generator
 	idGen idgen.IdGenerator
-	// Signer
-	signer types.Signer
+	// Latest block, shared by the batch
+	head *Head
 	// Configuration
 	contractAddr string
 	maxBlocks    uint
+	maxEntries   uint
+	// Template of allowance
+	allowanceTpl template
+	// State, an immutable *erc20ApprovalState swapped after every block
+	state atomic.Value
+}
+
+type erc20ApprovalState struct {
 	// State of the method
-	weight   uint
-	accessed []uint
+	accessed window
 	// State of the account list
-	accountsAccessed []uint
-	accountsFlat     [][2]string
-	// Current block
-	blk uint64
+	accounts keyList
 }
 
-func NewERC20ApprovalTracker(idGen idgen.IdGenerator, contractAddr string, maxBlocks uint) *ERC20ApprovalTracker {
-	return &ERC20ApprovalTracker{
-		idGen:            idGen,
-		signer:           types.NewLondonSigner(big.NewInt(1)),
-		contractAddr:     strings.ToLower(contractAddr),
-		maxBlocks:        maxBlocks,
-		weight:           0,
-		accessed:         make([]uint, maxBlocks),
-		accountsAccessed: make([]uint, maxBlocks),
-		accountsFlat:     make([][2]string, 0),
+func NewERC20ApprovalTracker(idGen idgen.IdGenerator, head *Head, contractAddr string, maxBlocks uint, maxEntries uint) *ERC20ApprovalTracker {
+	contractAddr = strings.ToLower(contractAddr)
+	t := &ERC20ApprovalTracker{
+		idGen:        idGen,
+		head:         head,
+		contractAddr: contractAddr,
+		maxBlocks:    maxBlocks,
+		maxEntries:   maxEntries,
+		allowanceTpl: compile(`{"jsonrpc":"2.0","id":$,"method":"eth_call","params":[{"to":"0x` + contractAddr + `","data":"0xdd62ed3e000000000000000000000000$000000000000000000000000$"}, $]}`),
 	}
+	t.state.Store(&erc20ApprovalState{
+		accounts: newKeyList(2 * common.AddressLength),
+	})
+	return t
 }
 
-func (t *ERC20ApprovalTracker) ApplyBlock(blk *types.Block) error {
+func (t *ERC20ApprovalTracker) load() *erc20ApprovalState {
+	return t.state.Load().(*erc20ApprovalState)
+}
+
+func (t *ERC20ApprovalTracker) ApplyBlock(blk *Block) error {
 	accessed := uint(0)
-	accountsToAdd := make([][2]string, 0)
+	accountsToAdd := make([]byte, 0)
 	// Apply block
-	for i := 0; i < blk.Transactions().Len(); i++ {
-		tx := blk.Transactions()[i]
-		if tx.To() == nil {
+	for _, i := range blk.Calls(t.contractAddr) {
+		tx := &blk.Txs[i]
+		if tx.Selector != "095ea7b3" {
 			continue
 		}
-		to := strings.ToLower(tx.To().String()[2:])
-		if to == t.contractAddr {
-			// Check method
-			if len(tx.Data()) < 4 {
-				continue
-			}
-			method := hex.EncodeToString(tx.Data()[:4])
-			if method == "095ea7b3" {
-				// approve
-				fromAddr, err := t.signer.Sender(tx)
-				if err != nil {
-					return err
-				}
-				owner := strings.ToLower(fromAddr.String()[2:])
-				spender := hex.EncodeToString(tx.Data()[16:36])
-				accountsToAdd = append(accountsToAdd, [][2]string{{owner, spender}}...)
-				// Method accessed once
-				accessed++
-			}
-		}
+		// approve
+		spender := common.BytesToAddress(tx.Transaction.Data()[16:36])
+		accountsToAdd = append(append(accountsToAdd, tx.From[:]...), spender[:]...)
+		// Method accessed once
+		accessed++
 	}
-	t.blk = blk.NumberU64()
+	s := t.load()
+	next := &erc20ApprovalState{}
 	// Update method state
-	// Pop
-	pop1 := t.accessed[t.maxBlocks-1]
-	t.weight -= pop1
-	t.accessed = t.accessed[:t.maxBlocks-1]
-	// Push
-	t.weight += accessed
-	t.accessed = append([]uint{accessed}, t.accessed...)
+	next.accessed, _ = s.accessed.push(blk.Number, accessed, t.maxBlocks)
 	// Update accounts state
-	// Pop
-	pop2 := t.accountsAccessed[t.maxBlocks-1]
-	t.accountsAccessed = t.accountsAccessed[:t.maxBlocks-1]
-	t.accountsFlat = t.accountsFlat[:len(t.accountsFlat)-int(pop2)]
-	// Push
-	t.accountsAccessed = append([]uint{uint(len(accountsToAdd))}, t.accountsAccessed...)
-	t.accountsFlat = append(accountsToAdd, t.accountsFlat...)
+	next.accounts = s.accounts.push(blk.Number, accountsToAdd, t.maxBlocks, t.maxEntries)
+	t.state.Store(next)
 	return nil
 }
 
 func (t *ERC20ApprovalTracker) CurrentWeight() uint {
-	return t.weight
+	return t.load().accessed.total
 }
 
-func (t *ERC20ApprovalTracker) GenerateQuery(number uint) ([]string, error) {
-	if len(t.accountsFlat) == 0 {
+func (t *ERC20ApprovalTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	s := t.load()
+	blk, parentHash := t.head.get()
+	if s.accounts.len() == 0 {
 		return nil, fmt.Errorf("empty accounts")
 	}
-	res := make([]string, number)
+	selector, err := newBlockSelector(opts, parentTags)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Query, number)
+	e := newEncoder()
 	for i := uint(0); i < number; i++ {
-		index := rand.Intn(len(t.accountsFlat))
-		id := t.idGen.Next()
-		res[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_call","params":[{"to":"0x%v","data":"0x%v"}, "0x%x"]}`, id, t.contractAddr, "dd62ed3e"+"000000000000000000000000"+t.accountsFlat[index][0]+"000000000000000000000000"+t.accountsFlat[index][1], t.blk-1)
+		accounts := s.accounts.random()
+		res[i] = Query{
+			Kind:     "token",
+			Tracker:  "erc20_approval",
+			Contract: t.contractAddr,
+			Method:   "dd62ed3e",
+		}
+		e.start(t.allowanceTpl, t.idGen.Next())
+		e.hex(accounts[:common.AddressLength])
+		e.hex(accounts[common.AddressLength:])
+		selector.encode(e, blk, parentHash)
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
 	}
 	return res, nil
 }
 
+func (t *ERC20ApprovalTracker) Memory() uint64 {
+	return t.load().accounts.bytes
+}
+
 func (t *ERC20ApprovalTracker) Status() string {
 	return ""
 }
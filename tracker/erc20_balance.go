@@ -1,121 +1,156 @@
 package tracker
 
 import (
-	"encoding/hex"
 	"fmt"
-	"math/big"
 	"math/rand"
 	"strings"
+	"sync/atomic"
 
-	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/wcgcyx/ethgen/idgen"
 )
 
 type ERC20BalanceTracker struct {
 	// Id generator
 	idGen idgen.IdGenerator
-	// Signer
-	signer types.Signer
+	// Latest block, shared by the batch
+	head *Head
 	// Configuration
 	contractAddr string
 	maxBlocks    uint
+	maxEntries   uint
+	// Templates of balanceOf, without and with a state override
+	balanceTpl  template
+	overrideTpl template
+	// Snapshot of the accounts list
+	snapshot []common.Address
+	// Slot of the balance mapping, nil if unknown and not overridden
+	balanceSlot *common.Hash
+	// State, an immutable *erc20BalanceState swapped after every block
+	state atomic.Value
+}
+
+type erc20BalanceState struct {
 	// State of the method
-	weight   uint
-	accessed []uint
+	accessed window
 	// State of the account list
-	accountsAccessed []uint
-	accountsFlat     []string
-	// Current block
-	blk uint64
+	accounts keyList
 }
 
-func NewERC20BalanceTracker(idGen idgen.IdGenerator, contractAddr string, maxBlocks uint) *ERC20BalanceTracker {
-	return &ERC20BalanceTracker{
-		idGen:            idGen,
-		signer:           types.NewLondonSigner(big.NewInt(1)),
-		contractAddr:     strings.ToLower(contractAddr),
-		maxBlocks:        maxBlocks,
-		weight:           0,
-		accessed:         make([]uint, maxBlocks),
-		accountsAccessed: make([]uint, maxBlocks),
-		accountsFlat:     make([]string, 0),
+func NewERC20BalanceTracker(idGen idgen.IdGenerator, head *Head, contractAddr string, maxBlocks uint, maxEntries uint, snapshot []string, balanceSlot *common.Hash) *ERC20BalanceTracker {
+	contractAddr = strings.ToLower(contractAddr)
+	call := `{"jsonrpc":"2.0","id":$,"method":"eth_call","params":[{"to":"0x` + contractAddr + `","data":"0x70a08231000000000000000000000000$"}, $`
+	t := &ERC20BalanceTracker{
+		idGen:        idGen,
+		head:         head,
+		contractAddr: contractAddr,
+		maxBlocks:    maxBlocks,
+		maxEntries:   maxEntries,
+		balanceTpl:   compile(call + `]}`),
+		overrideTpl:  compile(call + `, ` + balanceOverride(contractAddr) + `]}`),
+		snapshot:     make([]common.Address, len(snapshot)),
+		balanceSlot:  balanceSlot,
+	}
+	for i, account := range snapshot {
+		t.snapshot[i] = common.HexToAddress(account)
 	}
+	t.state.Store(&erc20BalanceState{
+		accounts: newKeyList(common.AddressLength),
+	})
+	return t
 }
 
-func (t *ERC20BalanceTracker) ApplyBlock(blk *types.Block) error {
+func (t *ERC20BalanceTracker) load() *erc20BalanceState {
+	return t.state.Load().(*erc20BalanceState)
+}
+
+func (t *ERC20BalanceTracker) ApplyBlock(blk *Block) error {
 	accessed := uint(0)
-	accountsToAdd := make([]string, 0)
+	accountsToAdd := make([]byte, 0)
 	// Apply block
-	for i := 0; i < blk.Transactions().Len(); i++ {
-		tx := blk.Transactions()[i]
-		if tx.To() == nil {
+	for _, i := range blk.Calls(t.contractAddr) {
+		tx := &blk.Txs[i]
+		if tx.Selector != "a9059cbb" && tx.Selector != "23b872dd" {
 			continue
 		}
-		to := strings.ToLower(tx.To().String()[2:])
-		if to == t.contractAddr {
-			// Check method
-			if len(tx.Data()) < 4 {
-				continue
-			}
-			method := hex.EncodeToString(tx.Data()[:4])
-			if method == "a9059cbb" {
-				// transfer
-				fromAddr, err := t.signer.Sender(tx)
-				if err != nil {
-					return err
-				}
-				sender := strings.ToLower(fromAddr.String()[2:])
-				recipient := hex.EncodeToString(tx.Data()[16:36])
-				accountsToAdd = append(accountsToAdd, []string{recipient, sender}...)
-				// Method accessed once
-				accessed++
-			} else if method == "23b872dd" {
-				// transferFrom
-				sender := hex.EncodeToString(tx.Data()[16:36])
-				recipient := hex.EncodeToString(tx.Data()[48:68])
-				accountsToAdd = append(accountsToAdd, []string{recipient, sender}...)
-				// Method accessed once
-				accessed++
-			}
+		data := tx.Transaction.Data()
+		if tx.Selector == "a9059cbb" {
+			// transfer
+			recipient := common.BytesToAddress(data[16:36])
+			accountsToAdd = append(append(accountsToAdd, recipient[:]...), tx.From[:]...)
+		} else {
+			// transferFrom
+			sender := common.BytesToAddress(data[16:36])
+			recipient := common.BytesToAddress(data[48:68])
+			accountsToAdd = append(append(accountsToAdd, recipient[:]...), sender[:]...)
 		}
+		// Method accessed once
+		accessed++
 	}
-	t.blk = blk.NumberU64()
+	s := t.load()
+	next := &erc20BalanceState{}
 	// Update method state
-	// Pop
-	pop1 := t.accessed[t.maxBlocks-1]
-	t.weight -= pop1
-	t.accessed = t.accessed[:t.maxBlocks-1]
-	// Push
-	t.weight += accessed
-	t.accessed = append([]uint{accessed}, t.accessed...)
+	next.accessed, _ = s.accessed.push(blk.Number, accessed, t.maxBlocks)
 	// Update accounts state
-	// Pop
-	pop2 := t.accountsAccessed[t.maxBlocks-1]
-	t.accountsAccessed = t.accountsAccessed[:t.maxBlocks-1]
-	t.accountsFlat = t.accountsFlat[:len(t.accountsFlat)-int(pop2)]
-	// Push
-	t.accountsAccessed = append([]uint{uint(len(accountsToAdd))}, t.accountsAccessed...)
-	t.accountsFlat = append(accountsToAdd, t.accountsFlat...)
+	next.accounts = s.accounts.push(blk.Number, accountsToAdd, t.maxBlocks, t.maxEntries)
+	t.state.Store(next)
 	return nil
 }
 
 func (t *ERC20BalanceTracker) CurrentWeight() uint {
-	return t.weight
+	return t.load().accessed.total
 }
 
-func (t *ERC20BalanceTracker) GenerateQuery(number uint) ([]string, error) {
-	if len(t.accountsFlat) == 0 {
+func (t *ERC20BalanceTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	s := t.load()
+	blk, parentHash := t.head.get()
+	if s.accounts.len() == 0 {
 		return nil, fmt.Errorf("empty accounts")
 	}
-	res := make([]string, number)
+	selector, err := newBlockSelector(opts, parentTags)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := opts.Snapshot && len(t.snapshot) > 0
+	res := make([]Query, number)
+	e := newEncoder()
 	for i := uint(0); i < number; i++ {
-		index := rand.Intn(len(t.accountsFlat))
-		id := t.idGen.Next()
-		res[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_call","params":[{"to":"0x%v","data":"0x%v"}, "0x%x"]}`, id, t.contractAddr, "70a08231000000000000000000000000"+t.accountsFlat[index], t.blk-1)
+		var account common.Address
+		if snapshot {
+			account = t.snapshot[rand.Intn(len(t.snapshot))]
+		} else {
+			account = common.BytesToAddress(s.accounts.random())
+		}
+		res[i] = Query{
+			Kind:     "token",
+			Tracker:  "erc20_balance",
+			Contract: t.contractAddr,
+			Method:   "70a08231",
+		}
+		if t.balanceSlot != nil && opts.override() {
+			res[i].Method = "70a08231:override"
+			slot := balanceSlot(account, *t.balanceSlot)
+			e.start(t.overrideTpl, t.idGen.Next())
+			e.hex(account[:])
+			selector.encode(e, blk, parentHash)
+			e.hex(slot[:])
+		} else {
+			e.start(t.balanceTpl, t.idGen.Next())
+			e.hex(account[:])
+			selector.encode(e, blk, parentHash)
+		}
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
 	}
 	return res, nil
 }
 
+func (t *ERC20BalanceTracker) Memory() uint64 {
+	return t.load().accounts.bytes
+}
+
 func (t *ERC20BalanceTracker) Status() string {
 	return ""
 }
@@ -4,33 +4,35 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 
-	"github.com/wcgcyx/ethgen/idgen"
-	"github.com/ethereum/go-ethereum/core/types"
 	wr "github.com/mroth/weightedrand"
+	"github.com/wcgcyx/ethgen/idgen"
 )
 
 type ERC721ContractTracker struct {
 	// Configuration
 	contractAddr string
 	maxBlocks    uint
-	// Contract state
-	weight   uint
-	accessed []uint
+	// Contract state, a window swapped after every block
+	accessed atomic.Value
+	// Latest block, shared by the batch
+	head *Head
 	// Sub-trackers
 	ownTracker Tracker
 	apvTracker Tracker
 }
 
-func NewERC721ContractTracker(idGen idgen.IdGenerator, contractAddr string, maxBlocks uint) *ERC721ContractTracker {
-	return &ERC721ContractTracker{
+func NewERC721ContractTracker(idGen idgen.IdGenerator, head *Head, contractAddr string, maxBlocks uint, maxEntries uint, snapshot []string) *ERC721ContractTracker {
+	t := &ERC721ContractTracker{
 		contractAddr: strings.ToLower(contractAddr),
 		maxBlocks:    maxBlocks,
-		weight:       0,
-		accessed:     make([]uint, maxBlocks),
-		ownTracker:   NewERC721OwnerTracker(idGen, contractAddr, maxBlocks),
-		apvTracker:   NewERC721ApprovalTracker(idGen, contractAddr, maxBlocks),
+		head:         head,
+		ownTracker:   NewERC721OwnerTracker(idGen, head, contractAddr, maxBlocks, maxEntries, snapshot),
+		apvTracker:   NewERC721ApprovalTracker(idGen, head, contractAddr, maxBlocks, maxEntries),
 	}
+	t.accessed.Store(window{})
+	return t
 }
 
 func (t *ERC721ContractTracker) Own() Tracker {
@@ -41,54 +43,29 @@ func (t *ERC721ContractTracker) Apv() Tracker {
 	return t.apvTracker
 }
 
-func (t *ERC721ContractTracker) ApplyBlock(blk *types.Block) error {
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		err := t.ownTracker.ApplyBlock(blk)
-		if err != nil {
-			fmt.Println(err.Error())
-		}
-	}()
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		err := t.apvTracker.ApplyBlock(blk)
-		if err != nil {
-			fmt.Println(err.Error())
-		}
-	}()
-	accessed := uint(0)
-	// Apply block
-	for i := 0; i < blk.Transactions().Len(); i++ {
-		tx := blk.Transactions()[i]
-		if tx.To() == nil {
-			continue
-		}
-		to := strings.ToLower(tx.To().String()[2:])
-		if to == t.contractAddr {
-			// Contract accessed once
-			accessed++
-		}
+func (t *ERC721ContractTracker) ApplyBlock(blk *Block) error {
+	t.head.set(blk)
+	err := t.ownTracker.ApplyBlock(blk)
+	if err != nil {
+		return err
+	}
+	err = t.apvTracker.ApplyBlock(blk)
+	if err != nil {
+		return err
 	}
+	// Contract accessed once per call
+	accessed := uint(len(blk.Calls(t.contractAddr)))
 	// Update method state
-	// Pop
-	pop1 := t.accessed[t.maxBlocks-1]
-	t.weight -= pop1
-	t.accessed = t.accessed[:t.maxBlocks-1]
-	// Push
-	t.weight += accessed
-	t.accessed = append([]uint{accessed}, t.accessed...)
-	wg.Wait()
+	next, _ := t.accessed.Load().(window).push(blk.Number, accessed, t.maxBlocks)
+	t.accessed.Store(next)
 	return nil
 }
 
 func (t *ERC721ContractTracker) CurrentWeight() uint {
-	return t.weight
+	return t.accessed.Load().(window).total
 }
 
-func (t *ERC721ContractTracker) GenerateQuery(number uint) ([]string, error) {
+func (t *ERC721ContractTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
 	contractChooser, err := wr.NewChooser(
 		wr.NewChoice(1, t.ownTracker.CurrentWeight()),
 		wr.NewChoice(2, t.apvTracker.CurrentWeight()),
@@ -106,14 +83,14 @@ func (t *ERC721ContractTracker) GenerateQuery(number uint) ([]string, error) {
 			apv++
 		}
 	}
-	var res1 []string
-	var res2 []string
+	var res1 []Query
+	var res2 []Query
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		var err error
-		res1, err = t.ownTracker.GenerateQuery(own)
+		res1, err = t.ownTracker.GenerateQuery(own, opts)
 		if err != nil {
 			fmt.Println(err.Error())
 		}
@@ -122,7 +99,7 @@ func (t *ERC721ContractTracker) GenerateQuery(number uint) ([]string, error) {
 	go func() {
 		defer wg.Done()
 		var err error
-		res2, err = t.apvTracker.GenerateQuery(apv)
+		res2, err = t.apvTracker.GenerateQuery(apv, opts)
 		if err != nil {
 			fmt.Println(err.Error())
 		}
@@ -131,6 +108,10 @@ func (t *ERC721ContractTracker) GenerateQuery(number uint) ([]string, error) {
 	return append(res1, res2...), nil
 }
 
+func (t *ERC721ContractTracker) Memory() uint64 {
+	return t.ownTracker.Memory() + t.apvTracker.Memory()
+}
+
 func (t *ERC721ContractTracker) Status() string {
 	return fmt.Sprintf("(%v-%v)", t.ownTracker.CurrentWeight(), t.apvTracker.CurrentWeight())
 }
@@ -1,114 +1,122 @@
 package tracker
 
 import (
-	"encoding/hex"
 	"fmt"
-	"math/big"
-	"math/rand"
 	"strings"
+	"sync/atomic"
 
-	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/wcgcyx/ethgen/idgen"
 )
 
 type ERC721ApprovalTracker struct {
 	// Id generator
 	idGen idgen.IdGenerator
-	// Signer
-	signer types.Signer
+	// Latest block, shared by the batch
+	head *Head
 	// Configuration
 	contractAddr string
 	maxBlocks    uint
+	maxEntries   uint
+	// Template of isApprovedForAll
+	approvedTpl template
+	// State, an immutable *erc721ApprovalState swapped after every block
+	state atomic.Value
+}
+
+type erc721ApprovalState struct {
 	// State of the method
-	weight   uint
-	accessed []uint
+	accessed window
 	// State of the nft list
-	nftAccessed []uint
-	nftsFlat    [][2]string
-	// Current block
-	blk uint64
+	nfts keyList
 }
 
-func NewERC721ApprovalTracker(idGen idgen.IdGenerator, contractAddr string, maxBlocks uint) *ERC721ApprovalTracker {
-	return &ERC721ApprovalTracker{
+func NewERC721ApprovalTracker(idGen idgen.IdGenerator, head *Head, contractAddr string, maxBlocks uint, maxEntries uint) *ERC721ApprovalTracker {
+	contractAddr = strings.ToLower(contractAddr)
+	t := &ERC721ApprovalTracker{
 		idGen:        idGen,
-		signer:       types.NewLondonSigner(big.NewInt(1)),
-		contractAddr: strings.ToLower(contractAddr),
+		head:         head,
+		contractAddr: contractAddr,
 		maxBlocks:    maxBlocks,
-		weight:       0,
-		accessed:     make([]uint, maxBlocks),
-		nftAccessed:  make([]uint, maxBlocks),
-		nftsFlat:     make([][2]string, 0),
+		maxEntries:   maxEntries,
+		approvedTpl:  compile(`{"jsonrpc":"2.0","id":$,"method":"eth_call","params":[{"to":"0x` + contractAddr + `","data":"0xe985e9c5000000000000000000000000$000000000000000000000000$"}, $]}`),
 	}
+	t.state.Store(&erc721ApprovalState{
+		nfts: newKeyList(2 * common.AddressLength),
+	})
+	return t
 }
 
-func (t *ERC721ApprovalTracker) ApplyBlock(blk *types.Block) error {
+func (t *ERC721ApprovalTracker) load() *erc721ApprovalState {
+	return t.state.Load().(*erc721ApprovalState)
+}
+
+func (t *ERC721ApprovalTracker) ApplyBlock(blk *Block) error {
 	accessed := uint(0)
-	nftsToAdd := make([][2]string, 0)
+	nftsToAdd := make([]byte, 0)
 	// Apply block
-	for i := 0; i < blk.Transactions().Len(); i++ {
-		tx := blk.Transactions()[i]
-		if tx.To() == nil {
+	for _, i := range blk.Calls(t.contractAddr) {
+		tx := &blk.Txs[i]
+		if tx.Selector != "a22cb465" {
 			continue
 		}
-		to := strings.ToLower(tx.To().String()[2:])
-		if to == t.contractAddr {
-			// Check method
-			if len(tx.Data()) < 4 {
-				continue
-			}
-			method := hex.EncodeToString(tx.Data()[:4])
-			if method == "a22cb465" {
-				// set approval for all
-				fromAddr, err := t.signer.Sender(tx)
-				if err != nil {
-					return err
-				}
-				owner := strings.ToLower(fromAddr.String()[2:])
-				operator := hex.EncodeToString(tx.Data()[36:68])
-				nftsToAdd = append(nftsToAdd, [][2]string{{owner, operator}}...)
-				// Method accessed once
-				accessed++
-			}
-		}
+		// set approval for all, the operator being the first argument, the
+		// last 20 bytes of the word following the selector
+		operator := common.BytesToAddress(tx.Transaction.Data()[16:36])
+		nftsToAdd = append(append(nftsToAdd, tx.From[:]...), operator[:]...)
+		// Method accessed once
+		accessed++
 	}
-	t.blk = blk.NumberU64()
+	s := t.load()
+	next := &erc721ApprovalState{}
 	// Update method state
-	// Pop
-	pop1 := t.accessed[t.maxBlocks-1]
-	t.weight -= pop1
-	t.accessed = t.accessed[:t.maxBlocks-1]
-	// Push
-	t.weight += accessed
-	t.accessed = append([]uint{accessed}, t.accessed...)
-	// Update accounts state
-	// Pop
-	pop2 := t.nftAccessed[t.maxBlocks-1]
-	t.nftAccessed = t.nftAccessed[:t.maxBlocks-1]
-	t.nftsFlat = t.nftsFlat[:len(t.nftsFlat)-int(pop2)]
-	// Push
-	t.nftAccessed = append([]uint{uint(len(nftsToAdd))}, t.nftAccessed...)
-	t.nftsFlat = append(nftsToAdd, t.nftsFlat...)
+	next.accessed, _ = s.accessed.push(blk.Number, accessed, t.maxBlocks)
+	// Update nfts state
+	next.nfts = s.nfts.push(blk.Number, nftsToAdd, t.maxBlocks, t.maxEntries)
+	t.state.Store(next)
 	return nil
 }
 
 func (t *ERC721ApprovalTracker) CurrentWeight() uint {
-	return t.weight
+	return t.load().accessed.total
 }
 
-func (t *ERC721ApprovalTracker) GenerateQuery(number uint) ([]string, error) {
-	if len(t.nftsFlat) == 0 {
+func (t *ERC721ApprovalTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	s := t.load()
+	blk, parentHash := t.head.get()
+	if s.nfts.len() == 0 {
 		return nil, fmt.Errorf("empty nfts")
 	}
-	res := make([]string, number)
+	selector, err := newBlockSelector(opts, parentTags)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Query, number)
+	e := newEncoder()
 	for i := uint(0); i < number; i++ {
-		index := rand.Intn(len(t.nftsFlat))
-		id := t.idGen.Next()
-		res[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_call","params":[{"to":"0x%v","data":"0x%v"}, "0x%x"]}`, id, t.contractAddr, "e985e9c5"+"000000000000000000000000"+t.nftsFlat[index][0]+"000000000000000000000000"+t.nftsFlat[index][1], t.blk-1)
+		accounts := s.nfts.random()
+		res[i] = Query{
+			Kind:     "token",
+			Tracker:  "erc721_approval",
+			Contract: t.contractAddr,
+			Method:   "e985e9c5",
+		}
+		e.start(t.approvedTpl, t.idGen.Next())
+		e.hex(accounts[:common.AddressLength])
+		e.hex(accounts[common.AddressLength:])
+		selector.encode(e, blk, parentHash)
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
 	}
 	return res, nil
 }
 
+func (t *ERC721ApprovalTracker) Memory() uint64 {
+	return t.load().nfts.bytes
+}
+
 func (t *ERC721ApprovalTracker) Status() string {
 	return ""
 }
@@ -1,109 +1,133 @@
 package tracker
 
 import (
-	"encoding/hex"
 	"fmt"
-	"math/big"
 	"math/rand"
 	"strings"
+	"sync/atomic"
 
-	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/wcgcyx/ethgen/idgen"
 )
 
 type ERC721OwnerTracker struct {
 	// Id generator
 	idGen idgen.IdGenerator
-	// Signer
-	signer types.Signer
+	// Latest block, shared by the batch
+	head *Head
 	// Configuration
 	contractAddr string
 	maxBlocks    uint
+	maxEntries   uint
+	// Template of ownerOf
+	ownerTpl template
+	// Snapshot of the nfts list
+	snapshot []common.Hash
+	// State, an immutable *erc721OwnerState swapped after every block
+	state atomic.Value
+}
+
+type erc721OwnerState struct {
 	// State of the method
-	weight   uint
-	accessed []uint
+	accessed window
 	// State of the nft list
-	nftAccessed []uint
-	nftsFlat    []string
-	// Current block
-	blk uint64
+	nfts keyList
 }
 
-func NewERC721OwnerTracker(idGen idgen.IdGenerator, contractAddr string, maxBlocks uint) *ERC721OwnerTracker {
-	return &ERC721OwnerTracker{
+func NewERC721OwnerTracker(idGen idgen.IdGenerator, head *Head, contractAddr string, maxBlocks uint, maxEntries uint, snapshot []string) *ERC721OwnerTracker {
+	contractAddr = strings.ToLower(contractAddr)
+	t := &ERC721OwnerTracker{
 		idGen:        idGen,
-		signer:       types.NewLondonSigner(big.NewInt(1)),
-		contractAddr: strings.ToLower(contractAddr),
+		head:         head,
+		contractAddr: contractAddr,
 		maxBlocks:    maxBlocks,
-		weight:       0,
-		accessed:     make([]uint, maxBlocks),
-		nftAccessed:  make([]uint, maxBlocks),
-		nftsFlat:     make([]string, 0),
+		maxEntries:   maxEntries,
+		ownerTpl:     compile(`{"jsonrpc":"2.0","id":$,"method":"eth_call","params":[{"to":"0x` + contractAddr + `","data":"0x6352211e$"}, $]}`),
+		snapshot:     make([]common.Hash, len(snapshot)),
+	}
+	for i, nft := range snapshot {
+		t.snapshot[i] = common.HexToHash(nft)
 	}
+	t.state.Store(&erc721OwnerState{
+		nfts: newKeyList(common.HashLength),
+	})
+	return t
 }
 
-func (t *ERC721OwnerTracker) ApplyBlock(blk *types.Block) error {
+func (t *ERC721OwnerTracker) load() *erc721OwnerState {
+	return t.state.Load().(*erc721OwnerState)
+}
+
+func (t *ERC721OwnerTracker) ApplyBlock(blk *Block) error {
 	accessed := uint(0)
-	nftsToAdd := make([]string, 0)
+	nftsToAdd := make([]byte, 0)
 	// Apply block
-	for i := 0; i < blk.Transactions().Len(); i++ {
-		tx := blk.Transactions()[i]
-		if tx.To() == nil {
+	for _, i := range blk.Calls(t.contractAddr) {
+		tx := &blk.Txs[i]
+		if tx.Selector != "b88d4fde" && tx.Selector != "42842e0e" && tx.Selector != "23b872dd" {
 			continue
 		}
-		to := strings.ToLower(tx.To().String()[2:])
-		if to == t.contractAddr {
-			// Check method
-			if len(tx.Data()) < 4 {
-				continue
-			}
-			method := hex.EncodeToString(tx.Data()[:4])
-			if method == "b88d4fde" || method == "42842e0e" || method == "23b872dd" {
-				// transfer from
-				nftId := hex.EncodeToString(tx.Data()[68:100])
-				nftsToAdd = append(nftsToAdd, nftId)
-				// Method accessed once
-				accessed++
-			}
-		}
+		// transfer from
+		nftId := common.BytesToHash(tx.Transaction.Data()[68:100])
+		nftsToAdd = append(nftsToAdd, nftId[:]...)
+		// Method accessed once
+		accessed++
 	}
-	t.blk = blk.NumberU64()
+	s := t.load()
+	next := &erc721OwnerState{}
 	// Update method state
-	// Pop
-	pop1 := t.accessed[t.maxBlocks-1]
-	t.weight -= pop1
-	t.accessed = t.accessed[:t.maxBlocks-1]
-	// Push
-	t.weight += accessed
-	t.accessed = append([]uint{accessed}, t.accessed...)
-	// Update accounts state
-	// Pop
-	pop2 := t.nftAccessed[t.maxBlocks-1]
-	t.nftAccessed = t.nftAccessed[:t.maxBlocks-1]
-	t.nftsFlat = t.nftsFlat[:len(t.nftsFlat)-int(pop2)]
-	// Push
-	t.nftAccessed = append([]uint{uint(len(nftsToAdd))}, t.nftAccessed...)
-	t.nftsFlat = append(nftsToAdd, t.nftsFlat...)
+	next.accessed, _ = s.accessed.push(blk.Number, accessed, t.maxBlocks)
+	// Update nfts state
+	next.nfts = s.nfts.push(blk.Number, nftsToAdd, t.maxBlocks, t.maxEntries)
+	t.state.Store(next)
 	return nil
 }
 
 func (t *ERC721OwnerTracker) CurrentWeight() uint {
-	return t.weight
+	return t.load().accessed.total
 }
 
-func (t *ERC721OwnerTracker) GenerateQuery(number uint) ([]string, error) {
-	if len(t.nftsFlat) == 0 {
+func (t *ERC721OwnerTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	s := t.load()
+	blk, parentHash := t.head.get()
+	if s.nfts.len() == 0 {
 		return nil, fmt.Errorf("empty nfts")
 	}
-	res := make([]string, number)
+	selector, err := newBlockSelector(opts, parentTags)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := opts.Snapshot && len(t.snapshot) > 0
+	res := make([]Query, number)
+	e := newEncoder()
 	for i := uint(0); i < number; i++ {
-		index := rand.Intn(len(t.nftsFlat))
-		id := t.idGen.Next()
-		res[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_call","params":[{"to":"0x%v","data":"0x%v"}, "0x%x"]}`, id, t.contractAddr, "6352211e"+t.nftsFlat[index], t.blk-1)
+		var nft []byte
+		if snapshot {
+			nft = t.snapshot[rand.Intn(len(t.snapshot))][:]
+		} else {
+			nft = s.nfts.random()
+		}
+		res[i] = Query{
+			Kind:     "token",
+			Tracker:  "erc721_owner",
+			Contract: t.contractAddr,
+			Method:   "6352211e",
+		}
+		e.start(t.ownerTpl, t.idGen.Next())
+		e.hex(nft)
+		selector.encode(e, blk, parentHash)
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
 	}
 	return res, nil
 }
 
+func (t *ERC721OwnerTracker) Memory() uint64 {
+	return t.load().nfts.bytes
+}
+
 func (t *ERC721OwnerTracker) Status() string {
 	return ""
 }
@@ -0,0 +1,116 @@
+package tracker
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/wcgcyx/ethgen/idgen"
+)
+
+// FeeMethods are the fee methods, eth_feeHistory, eth_gasPrice,
+// eth_maxPriorityFeePerGas, eth_chainId and net_version.
+var FeeMethods = []string{"fee_history", "gas_price", "max_priority_fee", "chain_id", "net_version"}
+
+var (
+	// Block counts of eth_feeHistory, as used by common wallets and libraries
+	feeHistoryBlockCounts = []uint{1, 4, 5, 10, 20, 100}
+	// Reward percentiles of eth_feeHistory
+	feeHistoryPercentiles = []string{"", "50", "25,50,75", "10,50,90", "5,25,50,75,95"}
+	// Templates of eth_feeHistory and of methods without parameters
+	feeHistoryTpl = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_feeHistory","params":["$",$,[$]]}`)
+	noParamsTpl   = compile(`{"jsonrpc":"2.0","id":$,"method":"$","params":[]}`)
+)
+
+// FeeTracker generates fee market queries, which only depend on the head.
+type FeeTracker struct {
+	// Id generator
+	idGen idgen.IdGenerator
+	// Configuration
+	methods map[string]uint
+	// Current block, a uint64 swapped after every block
+	blk atomic.Value
+}
+
+func NewFeeTracker(idGen idgen.IdGenerator, methods map[string]uint) *FeeTracker {
+	t := &FeeTracker{
+		idGen:   idGen,
+		methods: methods,
+	}
+	t.blk.Store(uint64(0))
+	return t
+}
+
+func (t *FeeTracker) ApplyBlock(blk *Block) error {
+	t.blk.Store(blk.Number)
+	return nil
+}
+
+// CurrentWeight is 1 once a block is applied, as fee queries do not depend
+// on the window.
+func (t *FeeTracker) CurrentWeight() uint {
+	if t.blk.Load().(uint64) == 0 {
+		return 0
+	}
+	return 1
+}
+
+func (t *FeeTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	blk := t.blk.Load().(uint64)
+	if blk == 0 {
+		return nil, fmt.Errorf("empty head")
+	}
+	methodChooser, err := newWeightedChooser(t.methods)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := newBlockSelector(opts, accountTags)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Query, number)
+	e := newEncoder()
+	for i := uint(0); i < number; i++ {
+		res[i] = Query{
+			Kind:     "fee",
+			Tracker:  "fee",
+			Contract: "",
+		}
+		switch methodChooser.Pick().(string) {
+		case "fee_history":
+			// The newest block is a number or tag, never a hash
+			res[i].Method = "eth_feeHistory"
+			e.start(feeHistoryTpl, t.idGen.Next())
+			e.quantity(uint64(feeHistoryBlockCounts[rand.Intn(len(feeHistoryBlockCounts))]))
+			selector.encode(e, blk, common.Hash{})
+			e.str(feeHistoryPercentiles[rand.Intn(len(feeHistoryPercentiles))])
+		case "gas_price":
+			res[i].Method = "eth_gasPrice"
+		case "max_priority_fee":
+			res[i].Method = "eth_maxPriorityFeePerGas"
+		case "chain_id":
+			res[i].Method = "eth_chainId"
+		default:
+			res[i].Method = "net_version"
+		}
+		if res[i].Method != "eth_feeHistory" {
+			e.start(noParamsTpl, t.idGen.Next())
+			e.str(res[i].Method)
+		}
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
+	}
+	return res, nil
+}
+
+// Memory is zero as the tracker only keeps the current block.
+func (t *FeeTracker) Memory() uint64 {
+	return 0
+}
+
+func (t *FeeTracker) Status() string {
+	return fmt.Sprintf("%v", t.blk.Load())
+}
@@ -0,0 +1,132 @@
+package tracker
+
+import (
+	"encoding/hex"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Block is a block decoded once for all trackers, with the senders
+// recovered and the transactions indexed by recipient.
+type Block struct {
+	Number     uint64
+	ParentHash common.Hash
+	Txs        []Tx
+	// Transactions whose sender cannot be recovered, which are skipped
+	Skipped uint
+	// Token calls with data too short for their method, which are not
+	// routed to contracts
+	Malformed uint
+	// Positions in Txs by recipient
+	byTo map[string][]int
+}
+
+// Tx is a decoded transaction.
+type Tx struct {
+	Transaction *types.Transaction
+	// Position in the block
+	Index uint
+	From  common.Address
+	// Recipient, zero for contract creations
+	Recipient common.Address
+	// Lowercase hex of the recipient without 0x, empty for contract
+	// creations
+	To string
+	// Hex of the method selector, empty if the data is shorter
+	Selector string
+}
+
+// Data length of the token methods read by trackers, the selector and the
+// arguments up to the last one read
+var callDataLengths = map[string]int{
+	"a9059cbb": 68,  // transfer(address,uint256)
+	"095ea7b3": 68,  // approve(address,uint256)
+	"23b872dd": 100, // transferFrom(address,address,uint256)
+	"42842e0e": 100, // safeTransferFrom(address,address,uint256)
+	"b88d4fde": 100, // safeTransferFrom(address,address,uint256,bytes)
+	"a22cb465": 68,  // setApprovalForAll(address,bool)
+}
+
+// NewBlock decodes a block, recovering every sender by the signer.
+func NewBlock(blk *types.Block, signer types.Signer) *Block {
+	return NewBlockWithPositions(blk, nil, signer)
+}
+
+// NewBlockWithPositions decodes a block whose transactions are a subset of
+// the original ones, at the given positions in the original block, nil if
+// all transactions are kept.
+func NewBlockWithPositions(blk *types.Block, positions []uint, signer types.Signer) *Block {
+	res := &Block{
+		Number:     blk.NumberU64(),
+		ParentHash: blk.ParentHash(),
+		Txs:        make([]Tx, 0, blk.Transactions().Len()),
+		byTo:       make(map[string][]int),
+	}
+	for i, tx := range blk.Transactions() {
+		fromAddr, err := signer.Sender(tx)
+		if err != nil {
+			res.Skipped++
+			continue
+		}
+		decoded := Tx{
+			Transaction: tx,
+			Index:       uint(i),
+			From:        fromAddr,
+		}
+		if positions != nil {
+			decoded.Index = positions[i]
+		}
+		if len(tx.Data()) >= 4 {
+			decoded.Selector = hex.EncodeToString(tx.Data()[:4])
+		}
+		if tx.To() != nil {
+			decoded.Recipient = *tx.To()
+			decoded.To = strings.ToLower(tx.To().String()[2:])
+			if length, ok := callDataLengths[decoded.Selector]; ok && len(tx.Data()) < length {
+				// Trackers slice the arguments of routed calls
+				res.Malformed++
+			} else {
+				res.byTo[decoded.To] = append(res.byTo[decoded.To], len(res.Txs))
+			}
+		}
+		res.Txs = append(res.Txs, decoded)
+	}
+	return res
+}
+
+// Calls gets the positions in Txs of the transactions calling a contract,
+// given as lowercase hex without 0x, token calls with short data excluded.
+func (b *Block) Calls(to string) []int {
+	return b.byTo[to]
+}
+
+// Head is the latest block applied, shared by the trackers of a batch so
+// trackers not routed a block still generate queries against the latest.
+type Head struct {
+	value atomic.Value
+}
+
+type headBlock struct {
+	number     uint64
+	parentHash common.Hash
+}
+
+func NewHead() *Head {
+	h := &Head{}
+	h.value.Store(headBlock{})
+	return h
+}
+
+// set sets the head to the block.
+func (h *Head) set(blk *Block) {
+	h.value.Store(headBlock{number: blk.Number, parentHash: blk.ParentHash})
+}
+
+// get gets the number and the parent hash of the head.
+func (h *Head) get() (uint64, common.Hash) {
+	head := h.value.Load().(headBlock)
+	return head.number, head.parentHash
+}
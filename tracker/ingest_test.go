@@ -0,0 +1,76 @@
+package tracker
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/wcgcyx/ethgen/idgen"
+)
+
+// TestTruncatedCalls applies token calls with data cut short, which must be
+// skipped rather than sliced.
+func TestTruncatedCalls(t *testing.T) {
+	key, err := crypto.ToECDSA(crypto.Keccak256([]byte("sender")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := types.LatestSignerForChainID(big.NewInt(1))
+	token := common.HexToAddress("dAC17F958D2ee523a2206206994597C13D831ec7")
+	recipient := common.LeftPadBytes(common.HexToAddress("5041ed759dd4afc3a72b8192c143f72f4724081a").Bytes(), 32)
+	amount := common.LeftPadBytes(big.NewInt(1).Bytes(), 32)
+	calls := [][]byte{
+		// transfer, valid
+		append(append(common.FromHex("a9059cbb"), recipient...), amount...),
+		// transfer, without the amount and with a partial recipient
+		append(common.FromHex("a9059cbb"), recipient[:20]...),
+		// approve, without the amount
+		append(common.FromHex("095ea7b3"), recipient[:30]...),
+		// transferFrom, without the token id
+		append(append(common.FromHex("23b872dd"), recipient...), recipient...),
+		// safeTransferFrom, selector only
+		common.FromHex("42842e0e"),
+		// setApprovalForAll, partial operator
+		append(common.FromHex("a22cb465"), recipient[:16]...),
+	}
+	txs := make([]*types.Transaction, len(calls))
+	for i, data := range calls {
+		txs[i], err = types.SignNewTx(key, signer, &types.DynamicFeeTx{
+			ChainID:   big.NewInt(1),
+			Nonce:     uint64(i),
+			GasTipCap: big.NewInt(2e9),
+			GasFeeCap: big.NewInt(50e9),
+			Gas:       100000,
+			To:        &token,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	header := &types.Header{Number: big.NewInt(100)}
+	blk := NewBlock(types.NewBlockWithHeader(header).WithBody(txs, nil), signer)
+	if blk.Malformed != uint(len(calls)-1) {
+		t.Fatalf("expect %v malformed calls, got %v", len(calls)-1, blk.Malformed)
+	}
+	if len(blk.Txs) != len(calls) {
+		t.Fatalf("expect %v transactions, got %v", len(calls), len(blk.Txs))
+	}
+	idGen := idgen.NewIdGenerator()
+	erc20 := NewERC20BatchTracker(idGen, []string{token.Hex()[2:]}, 10, 0, nil, nil)
+	erc721 := NewERC721BatchTracker(idGen, []string{token.Hex()[2:]}, 10, 0, nil)
+	for _, tracker := range []Tracker{erc20, erc721} {
+		err = tracker.ApplyBlock(blk)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if erc20.CurrentWeight() != 1 {
+		t.Fatalf("expect the valid transfer only, got weight %v", erc20.CurrentWeight())
+	}
+	if erc721.CurrentWeight() != 1 {
+		t.Fatalf("expect the valid transfer only, got weight %v", erc721.CurrentWeight())
+	}
+}
@@ -0,0 +1,153 @@
+package tracker
+
+// Approximate bytes of an entry of the index of an intern table beyond the
+// key, the string header, the value and the bucket overhead.
+const internEntryBytes = 32
+
+// internTable interns fixed-size keys, counting the occurrences of every
+// key. It is owned by the importer, only the slab is read by generation.
+//
+// Keys are appended to the slab and never overwritten, so snapshots holding
+// a shorter slab stay valid. Keys whose occurrences drop to zero leave dead
+// slots, which are reclaimed by compacting into a new table.
+type internTable struct {
+	size int
+	// Keys, size bytes each
+	slab []byte
+	// Slot of every live key
+	index map[string]uint32
+	// Occurrences of every slot
+	counts []uint32
+	live   int
+}
+
+func newInternTable(size int) *internTable {
+	return &internTable{
+		size:  size,
+		index: make(map[string]uint32),
+	}
+}
+
+// intern gets the slot of a key, adding an occurrence.
+func (t *internTable) intern(key []byte) uint32 {
+	slot, ok := t.index[string(key)]
+	if !ok {
+		slot = uint32(len(t.counts))
+		t.slab = append(t.slab, key...)
+		t.index[string(key)] = slot
+		t.counts = append(t.counts, 0)
+		t.live++
+	}
+	t.counts[slot]++
+	return slot
+}
+
+// release removes an occurrence of the key in a slot.
+func (t *internTable) release(slot uint32) {
+	t.counts[slot]--
+	if t.counts[slot] == 0 {
+		delete(t.index, string(t.key(slot)))
+		t.live--
+	}
+}
+
+func (t *internTable) key(slot uint32) []byte {
+	return t.slab[int(slot)*t.size : int(slot+1)*t.size]
+}
+
+// compact gets a table of the live keys and the new slot of every old one.
+func (t *internTable) compact() (*internTable, []uint32) {
+	res := newInternTable(t.size)
+	res.slab = make([]byte, 0, t.live*t.size)
+	res.counts = make([]uint32, 0, t.live)
+	remap := make([]uint32, len(t.counts))
+	for slot, count := range t.counts {
+		if count == 0 {
+			continue
+		}
+		key := t.key(uint32(slot))
+		remap[slot] = uint32(len(res.counts))
+		res.slab = append(res.slab, key...)
+		res.index[string(key)] = remap[slot]
+		res.counts = append(res.counts, count)
+		res.live++
+	}
+	return res, remap
+}
+
+// memory estimates the bytes held by the table.
+func (t *internTable) memory() uint64 {
+	return uint64(cap(t.slab)) + uint64(4*cap(t.counts)) + uint64(t.live*(t.size+internEntryBytes))
+}
+
+// keyList is an immutable list of the keys seen in a window, an entry per
+// occurrence, oldest first, sampled if capped. Entries are the 4-byte slots
+// of the keys in an intern table shared by successive lists.
+type keyList struct {
+	entries sampledWindow
+	flat    []uint32
+	// Table of the importer, and the slab as of this list
+	table *internTable
+	slab  []byte
+	size  int
+	// Estimated bytes held
+	bytes uint64
+}
+
+func newKeyList(size int) keyList {
+	return keyList{
+		table: newInternTable(size),
+		size:  size,
+	}
+}
+
+// push gets the list with the keys of a new block, concatenated, evicting
+// the blocks leaving the window. Under a cap of entries, zero for none, the
+// block keeps a sample of its keys.
+func (l keyList) push(number uint64, added []byte, maxBlocks uint, maxEntries uint) keyList {
+	count := uint(len(added) / l.size)
+	positions := reservoir(count, budget(maxEntries, maxBlocks))
+	slots := make([]uint32, 0, count)
+	if positions == nil {
+		for i := 0; i < int(count); i++ {
+			slots = append(slots, l.table.intern(added[i*l.size:(i+1)*l.size]))
+		}
+	} else {
+		for _, i := range positions {
+			slots = append(slots, l.table.intern(added[i*l.size:(i+1)*l.size]))
+		}
+	}
+	var pop uint
+	next := keyList{
+		table: l.table,
+		size:  l.size,
+	}
+	next.entries, pop = l.entries.push(number, count, uint(len(slots)), maxBlocks)
+	for _, slot := range l.flat[:pop] {
+		next.table.release(slot)
+	}
+	next.flat = append(l.flat[pop:], slots...)
+	// Compact once dead slots outnumber live keys
+	if dead := len(next.table.counts) - next.table.live; dead > 64 && dead > next.table.live {
+		var remap []uint32
+		next.table, remap = next.table.compact()
+		flat := make([]uint32, len(next.flat))
+		for i, slot := range next.flat {
+			flat[i] = remap[slot]
+		}
+		next.flat = flat
+	}
+	next.slab = next.table.slab
+	next.bytes = uint64(4*cap(next.flat)) + next.entries.memory() + next.table.memory()
+	return next
+}
+
+func (l keyList) len() int {
+	return len(l.flat)
+}
+
+// random gets the key of a random occurrence, to be read only.
+func (l keyList) random() []byte {
+	slot := int(l.flat[l.entries.pick()])
+	return l.slab[slot*l.size : (slot+1)*l.size]
+}
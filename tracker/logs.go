@@ -0,0 +1,311 @@
+package tracker
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/wcgcyx/ethgen/idgen"
+)
+
+// LogFetcher fetches the logs emitted in a block.
+type LogFetcher func(number uint64) ([]types.Log, error)
+
+// LogsConfig is the configuration of generated eth_getLogs queries.
+type LogsConfig struct {
+	// Weights of block ranges:
+	// single for the block of a log,
+	// recent for the last blocks up to RecentRange,
+	// deep for since a block up to DeepRange ago.
+	Ranges      map[string]uint
+	RecentRange uint
+	DeepRange   uint
+	// Weights of filters:
+	// address for all logs of a contract,
+	// event for an event of a contract,
+	// indexed for an event of a contract with its first indexed topic,
+	// topic for an event of any contract,
+	// multi for events of multiple contracts.
+	Filters      map[string]uint
+	MaxAddresses uint
+}
+
+var (
+	LogsRanges  = []string{"single", "recent", "deep"}
+	LogsFilters = []string{"address", "event", "indexed", "topic", "multi"}
+	// Template of eth_getLogs, the filter being a hole
+	logsTpl = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getLogs","params":[{$}]}`)
+	// Method names in categories by range and filter
+	logsMethods = make(map[string]map[string]string)
+)
+
+func init() {
+	for _, rangeKind := range LogsRanges {
+		logsMethods[rangeKind] = make(map[string]string)
+		for _, filterKind := range LogsFilters {
+			logsMethods[rangeKind][filterKind] = "eth_getLogs:" + rangeKind + ":" + filterKind
+		}
+	}
+}
+
+type LogsTracker struct {
+	// Id generator
+	idGen idgen.IdGenerator
+	// Log fetcher, nil if logs are not tracked
+	fetcher LogFetcher
+	// Configuration
+	maxBlocks  uint
+	maxEntries uint
+	cfg        LogsConfig
+	// State, an immutable *logsState swapped after every block
+	state atomic.Value
+}
+
+type logsState struct {
+	// State of the method
+	accessed window
+	// State of the log list
+	logsSampled sampledWindow
+	logsFlat    []logEntry
+	// Current block
+	blk uint64
+}
+
+type logEntry struct {
+	address common.Address
+	// The event signature and the first indexed topic if indexed
+	topics  [2]common.Hash
+	indexed bool
+	number  uint64
+}
+
+func NewLogsTracker(idGen idgen.IdGenerator, fetcher LogFetcher, maxBlocks uint, maxEntries uint, cfg LogsConfig) *LogsTracker {
+	t := &LogsTracker{
+		idGen:      idGen,
+		fetcher:    fetcher,
+		maxBlocks:  maxBlocks,
+		maxEntries: maxEntries,
+		cfg:        cfg,
+	}
+	t.state.Store(&logsState{})
+	return t
+}
+
+func (t *LogsTracker) load() *logsState {
+	return t.state.Load().(*logsState)
+}
+
+func (t *LogsTracker) ApplyBlock(blk *Block) error {
+	accessed := uint(0)
+	logsToAdd := make([]logEntry, 0)
+	// Apply block
+	var logs []types.Log
+	var fetchErr error
+	if t.fetcher != nil {
+		logs, fetchErr = t.fetcher(blk.Number)
+	}
+	for _, log := range logs {
+		if log.Removed || len(log.Topics) == 0 {
+			continue
+		}
+		entry := logEntry{
+			address: log.Address,
+			number:  log.BlockNumber,
+		}
+		entry.topics[0] = log.Topics[0]
+		if len(log.Topics) > 1 {
+			entry.topics[1] = log.Topics[1]
+			entry.indexed = true
+		}
+		logsToAdd = append(logsToAdd, entry)
+		// Method accessed once
+		accessed++
+	}
+	s := t.load()
+	next := &logsState{
+		blk: blk.Number,
+	}
+	// Update method state
+	next.accessed, _ = s.accessed.push(blk.Number, accessed, t.maxBlocks)
+	// Update logs state
+	kept := logsToAdd
+	if positions := reservoir(uint(len(logsToAdd)), budget(t.maxEntries, t.maxBlocks)); positions != nil {
+		kept = make([]logEntry, len(positions))
+		for j, i := range positions {
+			kept[j] = logsToAdd[i]
+		}
+	}
+	var pop uint
+	next.logsSampled, pop = s.logsSampled.push(blk.Number, uint(len(logsToAdd)), uint(len(kept)), t.maxBlocks)
+	next.logsFlat = append(s.logsFlat[pop:], kept...)
+	t.state.Store(next)
+	if fetchErr != nil {
+		return fmt.Errorf("fail to fetch logs of block %v: %v", blk.Number, fetchErr.Error())
+	}
+	return nil
+}
+
+func (t *LogsTracker) CurrentWeight() uint {
+	return t.load().accessed.total
+}
+
+func (t *LogsTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	if t.fetcher == nil {
+		return nil, fmt.Errorf("logs not tracked")
+	}
+	s := t.load()
+	if len(s.logsFlat) == 0 {
+		return nil, fmt.Errorf("empty logs")
+	}
+	rangeChooser, err := newWeightedChooser(t.cfg.Ranges)
+	if err != nil {
+		return nil, err
+	}
+	filterChooser, err := newWeightedChooser(t.cfg.Filters)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Query, number)
+	e := newEncoder()
+	for i := uint(0); i < number; i++ {
+		entry := s.logsFlat[s.logsSampled.pick()]
+		rangeKind := rangeChooser.Pick().(string)
+		filterKind := filterChooser.Pick().(string)
+		res[i] = Query{
+			Kind:    "logs",
+			Tracker: "logs",
+			Method:  logsMethods[rangeKind][filterKind],
+		}
+		e.start(logsTpl, t.idGen.Next())
+		// Block range
+		switch rangeKind {
+		case "single":
+			e.buf = append(e.buf, `"fromBlock":"`...)
+			e.appendQuantity(entry.number)
+			e.buf = append(e.buf, `","toBlock":"`...)
+			e.appendQuantity(entry.number)
+		case "recent":
+			size := uint64(1 + rand.Intn(int(maxUint(t.cfg.RecentRange, 1))))
+			e.buf = append(e.buf, `"fromBlock":"`...)
+			e.appendQuantity(subFloor(s.blk, size))
+			e.buf = append(e.buf, `","toBlock":"`...)
+			e.appendQuantity(s.blk - 1)
+		default:
+			// Log-uniform between the recent range and the deep range
+			lo := math.Log(float64(maxUint(t.cfg.RecentRange, 1)))
+			hi := math.Log(float64(maxUint(t.cfg.DeepRange, t.cfg.RecentRange+1)))
+			size := uint64(math.Exp(lo + rand.Float64()*(hi-lo)))
+			e.buf = append(e.buf, `"fromBlock":"`...)
+			e.appendQuantity(subFloor(s.blk, size))
+			e.buf = append(e.buf, `","toBlock":"latest`...)
+		}
+		e.buf = append(e.buf, `",`...)
+		// Filter
+		switch filterKind {
+		case "address":
+			res[i].Contract = contractName(entry.address)
+			e.buf = append(e.buf, `"address":`...)
+			e.appendQuoted(entry.address[:])
+		case "event", "indexed":
+			res[i].Contract = contractName(entry.address)
+			e.buf = append(e.buf, `"address":`...)
+			e.appendQuoted(entry.address[:])
+			e.buf = append(e.buf, `,"topics":[`...)
+			e.appendQuoted(entry.topics[0][:])
+			if filterKind == "indexed" && entry.indexed {
+				e.buf = append(e.buf, ',')
+				e.appendQuoted(entry.topics[1][:])
+			}
+			e.buf = append(e.buf, ']')
+		case "topic":
+			e.buf = append(e.buf, `"topics":[`...)
+			e.appendQuoted(entry.topics[0][:])
+			e.buf = append(e.buf, ']')
+		default:
+			t.multiFilter(e, s)
+		}
+		e.next()
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
+	}
+	return res, nil
+}
+
+// multiFilter encodes a filter of events from multiple contracts in the logs.
+func (t *LogsTracker) multiFilter(e *encoder, s *logsState) {
+	number := 2 + rand.Intn(int(maxUint(t.cfg.MaxAddresses, 2))-1)
+	addresses := make([]common.Address, 0, number)
+	topics := make([]common.Hash, 0, number)
+	for i := 0; i < number; i++ {
+		entry := s.logsFlat[s.logsSampled.pick()]
+		if !containsAddress(addresses, entry.address) {
+			addresses = append(addresses, entry.address)
+		}
+		if !containsHash(topics, entry.topics[0]) {
+			topics = append(topics, entry.topics[0])
+		}
+	}
+	e.buf = append(e.buf, `"address":[`...)
+	for i, address := range addresses {
+		if i > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.appendQuoted(address[:])
+	}
+	e.buf = append(e.buf, `],"topics":[[`...)
+	for i, topic := range topics {
+		if i > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.appendQuoted(topic[:])
+	}
+	e.buf = append(e.buf, `]]`...)
+}
+
+func containsAddress(list []common.Address, addr common.Address) bool {
+	for _, item := range list {
+		if item == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func containsHash(list []common.Hash, hash common.Hash) bool {
+	for _, item := range list {
+		if item == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *LogsTracker) Memory() uint64 {
+	s := t.load()
+	return uint64(cap(s.logsFlat))*uint64(unsafe.Sizeof(logEntry{})) + s.logsSampled.memory()
+}
+
+func (t *LogsTracker) Status() string {
+	return fmt.Sprintf("%v", t.CurrentWeight())
+}
+
+func maxUint(a uint, b uint) uint {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// subFloor gets a - b, or 0 if b is larger.
+func subFloor(a uint64, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
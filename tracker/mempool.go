@@ -0,0 +1,204 @@
+package tracker
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/wcgcyx/ethgen/idgen"
+)
+
+// MempoolMethods are the methods simulating pending transactions, eth_call
+// and eth_estimateGas.
+var MempoolMethods = []string{"call", "estimate"}
+
+// Default block parameters of pending transactions
+var mempoolTags = map[string]uint{"pending": 1, "latest": 1}
+
+// MempoolTracker keeps a rolling set of pending transactions, added as they
+// arrive and removed once mined.
+type MempoolTracker struct {
+	// Id generator
+	idGen idgen.IdGenerator
+	// Signer
+	signer types.Signer
+	// Configuration
+	maxTransactions uint
+	methods         map[string]uint
+	strip           map[string]bool
+	// Pending transactions, guarded by the lock held by writers only
+	pending map[common.Hash]bool
+	lock    sync.Mutex
+	// State, an immutable *mempoolState swapped after every change
+	state atomic.Value
+}
+
+type mempoolState struct {
+	// State of pending transactions, oldest first
+	pendingFlat []pendingTransaction
+	// Current block and its parent hash
+	blk        uint64
+	parentHash common.Hash
+}
+
+type pendingTransaction struct {
+	transaction *types.Transaction
+	hash        common.Hash
+	// Called contract, empty for contract creations
+	contract string
+	// Call object simulating the transaction, without the stripped fields
+	call string
+	// Names in categories of eth_call and eth_estimateGas
+	names [2]string
+}
+
+func NewMempoolTracker(idGen idgen.IdGenerator, signer types.Signer, maxTransactions uint, methods map[string]uint, strip map[string]bool) *MempoolTracker {
+	t := &MempoolTracker{
+		idGen:           idGen,
+		signer:          signer,
+		maxTransactions: maxTransactions,
+		methods:         methods,
+		strip:           strip,
+		pending:         make(map[common.Hash]bool),
+		lock:            sync.Mutex{},
+	}
+	t.state.Store(&mempoolState{})
+	return t
+}
+
+func (t *MempoolTracker) load() *mempoolState {
+	return t.state.Load().(*mempoolState)
+}
+
+// AddTransaction adds a pending transaction, evicting the oldest if full.
+func (t *MempoolTracker) AddTransaction(tx *types.Transaction) error {
+	fromAddr, err := t.signer.Sender(tx)
+	if err != nil {
+		return err
+	}
+	pending := pendingTransaction{
+		transaction: tx,
+		hash:        tx.Hash(),
+		call:        callObject(tx, fromAddr, t.strip),
+	}
+	selector := ""
+	if len(tx.Data()) >= 4 {
+		selector = hex.EncodeToString(tx.Data()[:4])
+	}
+	if tx.To() == nil {
+		selector = "create"
+	} else {
+		pending.contract = strings.ToLower(tx.To().String()[2:])
+	}
+	pending.names = [2]string{"eth_call:" + selector, "eth_estimateGas:" + selector}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.pending[pending.hash] {
+		return nil
+	}
+	t.pending[pending.hash] = true
+	s := t.load()
+	pendingFlat := s.pendingFlat
+	if len(pendingFlat) > 0 && uint(len(pendingFlat)) >= t.maxTransactions {
+		delete(t.pending, pendingFlat[0].hash)
+		pendingFlat = pendingFlat[1:]
+	}
+	t.state.Store(&mempoolState{
+		pendingFlat: append(pendingFlat, pending),
+		blk:         s.blk,
+		parentHash:  s.parentHash,
+	})
+	return nil
+}
+
+// ApplyBlock removes the mined transactions.
+func (t *MempoolTracker) ApplyBlock(blk *Block) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	next := &mempoolState{
+		pendingFlat: t.load().pendingFlat,
+		blk:         blk.Number,
+		parentHash:  blk.ParentHash,
+	}
+	mined := false
+	for _, tx := range blk.Txs {
+		if t.pending[tx.Transaction.Hash()] {
+			delete(t.pending, tx.Transaction.Hash())
+			mined = true
+		}
+	}
+	if mined {
+		// Copied as the remaining transactions are not contiguous
+		pendingFlat := make([]pendingTransaction, 0, len(t.pending))
+		for _, tx := range next.pendingFlat {
+			if t.pending[tx.hash] {
+				pendingFlat = append(pendingFlat, tx)
+			}
+		}
+		next.pendingFlat = pendingFlat
+	}
+	t.state.Store(next)
+	return nil
+}
+
+func (t *MempoolTracker) CurrentWeight() uint {
+	return uint(len(t.load().pendingFlat))
+}
+
+func (t *MempoolTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	s := t.load()
+	if len(s.pendingFlat) == 0 || s.blk == 0 {
+		return nil, fmt.Errorf("empty pending transactions")
+	}
+	methodChooser, err := newWeightedChooser(t.methods)
+	if err != nil {
+		return nil, err
+	}
+	blockTags, err := newBlockSelector(opts, mempoolTags)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Query, number)
+	e := newEncoder()
+	for i := uint(0); i < number; i++ {
+		tx := s.pendingFlat[rand.Intn(len(s.pendingFlat))]
+		// Methods share the templates of replayed transactions
+		method := 0
+		if methodChooser.Pick().(string) != "call" {
+			method = 1
+		}
+		res[i] = Query{
+			Kind:     "mempool",
+			Tracker:  "mempool",
+			Contract: tx.contract,
+			Method:   tx.names[method],
+		}
+		e.start(replayTpls[method], t.idGen.Next())
+		e.str(tx.call)
+		blockTags.encode(e, s.blk, s.parentHash)
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
+	}
+	return res, nil
+}
+
+func (t *MempoolTracker) Memory() uint64 {
+	pending := t.load().pendingFlat
+	memory := uint64(cap(pending)) * uint64(unsafe.Sizeof(pendingTransaction{}))
+	for _, tx := range pending {
+		memory += uint64(tx.transaction.Size()) + uint64(len(tx.contract)+len(tx.call)+len(tx.names[0])+len(tx.names[1]))
+	}
+	return memory
+}
+
+func (t *MempoolTracker) Status() string {
+	return fmt.Sprintf("%v", t.CurrentWeight())
+}
@@ -0,0 +1,59 @@
+package tracker
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// Balance of funded accounts, 10^30 wei
+	overrideBalance = new(big.Int).Exp(big.NewInt(10), big.NewInt(30), nil)
+	// Balance as a quantity and as a storage word
+	overrideBalanceQuantity = fmt.Sprintf("0x%x", overrideBalance)
+	overrideBalanceWord     = fmt.Sprintf("0x%064x", overrideBalance)
+	// Hashers of balance slots
+	keccakPool = sync.Pool{
+		New: func() interface{} {
+			return crypto.NewKeccakState()
+		},
+	}
+)
+
+// override decides whether a call carries a state override, by the share of
+// the options.
+func (opts GenerateOptions) override() bool {
+	return rand.Intn(100) < int(opts.OverrideShare)
+}
+
+// fundOverride gets the template format of the state override funding an
+// account, the account being a hole.
+func fundOverride() string {
+	return `{"0x$":{"balance":"` + overrideBalanceQuantity + `"}}`
+}
+
+// balanceOverride gets the template format of the state override patching
+// the ERC20 balance of a holder of the contract, given as lowercase hex
+// without 0x, the balance slot being a hole.
+func balanceOverride(contract string) string {
+	return `{"0x` + contract + `":{"stateDiff":{"0x$":"` + overrideBalanceWord + `"}}}`
+}
+
+// balanceSlot gets the slot of the ERC20 balance of a holder, in the balance
+// mapping at the given slot.
+func balanceSlot(holder common.Address, mapping common.Hash) common.Hash {
+	var key [64]byte
+	copy(key[12:32], holder[:])
+	copy(key[32:], mapping[:])
+	hasher := keccakPool.Get().(crypto.KeccakState)
+	hasher.Reset()
+	hasher.Write(key[:])
+	var slot common.Hash
+	hasher.Read(slot[:])
+	keccakPool.Put(hasher)
+	return slot
+}
@@ -0,0 +1,62 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// Snapshot is a historical snapshot of token holders and token ids, which
+// can be sampled instead of the live window by archive queries.
+type Snapshot struct {
+	// Holders by ERC20 contract
+	ERC20 map[string][]string `json:"erc20"`
+	// Token ids by ERC721 contract, decimal or 0x prefixed hex
+	ERC721 map[string][]string `json:"erc721"`
+}
+
+// LoadSnapshot loads a snapshot from a json file, normalising contracts and
+// holders to lowercase hex without 0x and token ids to 32 bytes hex.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := Snapshot{}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, err
+	}
+	res := &Snapshot{
+		ERC20:  make(map[string][]string),
+		ERC721: make(map[string][]string),
+	}
+	for contract, holders := range raw.ERC20 {
+		key := normaliseAddress(contract)
+		for _, holder := range holders {
+			account := normaliseAddress(holder)
+			if len(account) != 40 {
+				return nil, fmt.Errorf("invalid holder %v of %v", holder, contract)
+			}
+			res.ERC20[key] = append(res.ERC20[key], account)
+		}
+	}
+	for contract, ids := range raw.ERC721 {
+		key := normaliseAddress(contract)
+		for _, id := range ids {
+			tokenID, ok := new(big.Int).SetString(id, 0)
+			if !ok || tokenID.Sign() < 0 || tokenID.BitLen() > 256 {
+				return nil, fmt.Errorf("invalid token id %v of %v", id, contract)
+			}
+			res.ERC721[key] = append(res.ERC721[key], fmt.Sprintf("%064x", tokenID))
+		}
+	}
+	return res, nil
+}
+
+// normaliseAddress gets the lowercase hex of an address without 0x.
+func normaliseAddress(addr string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(addr)), "0x")
+}
@@ -0,0 +1,169 @@
+package tracker
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/wcgcyx/ethgen/idgen"
+)
+
+// StorageFetcher fetches the storage slots touched in a block, in addition
+// to the access lists of its transactions.
+type StorageFetcher func(number uint64) (types.AccessList, error)
+
+// StorageMethods are the storage methods, eth_getStorageAt and eth_getProof.
+var StorageMethods = []string{"storage_at", "proof"}
+
+var (
+	// Templates of eth_getStorageAt and eth_getProof
+	storageAtTpl = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getStorageAt","params":["0x$","0x$",$]}`)
+	proofTpl     = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getProof","params":["0x$",["0x$"],$]}`)
+)
+
+type StorageTracker struct {
+	// Id generator
+	idGen idgen.IdGenerator
+	// Storage fetcher, nil if only access lists are used
+	fetcher StorageFetcher
+	// Configuration
+	maxBlocks  uint
+	maxEntries uint
+	methods    map[string]uint
+	// State, an immutable *storageState swapped after every block
+	state atomic.Value
+}
+
+type storageState struct {
+	// State of the method
+	accessed window
+	// State of the slot list
+	slots keyList
+	// Current block and its parent hash
+	blk        uint64
+	parentHash common.Hash
+}
+
+type storageEntry struct {
+	address common.Address
+	slot    common.Hash
+}
+
+func NewStorageTracker(idGen idgen.IdGenerator, fetcher StorageFetcher, maxBlocks uint, maxEntries uint, methods map[string]uint) *StorageTracker {
+	t := &StorageTracker{
+		idGen:      idGen,
+		fetcher:    fetcher,
+		maxBlocks:  maxBlocks,
+		maxEntries: maxEntries,
+		methods:    methods,
+	}
+	t.state.Store(&storageState{
+		slots: newKeyList(common.AddressLength + common.HashLength),
+	})
+	return t
+}
+
+func (t *StorageTracker) load() *storageState {
+	return t.state.Load().(*storageState)
+}
+
+func (t *StorageTracker) ApplyBlock(blk *Block) error {
+	accessed := uint(0)
+	slotsToAdd := make([]byte, 0)
+	seen := make(map[storageEntry]bool)
+	add := func(accessList types.AccessList) {
+		for _, tuple := range accessList {
+			for _, key := range tuple.StorageKeys {
+				entry := storageEntry{
+					address: tuple.Address,
+					slot:    key,
+				}
+				if seen[entry] {
+					continue
+				}
+				seen[entry] = true
+				slotsToAdd = append(append(slotsToAdd, entry.address[:]...), entry.slot[:]...)
+				// Method accessed once
+				accessed++
+			}
+		}
+	}
+	// Apply block
+	for _, tx := range blk.Txs {
+		add(tx.Transaction.AccessList())
+	}
+	var fetchErr error
+	if t.fetcher != nil {
+		var accessList types.AccessList
+		accessList, fetchErr = t.fetcher(blk.Number)
+		add(accessList)
+	}
+	s := t.load()
+	next := &storageState{
+		blk:        blk.Number,
+		parentHash: blk.ParentHash,
+	}
+	// Update method state
+	next.accessed, _ = s.accessed.push(blk.Number, accessed, t.maxBlocks)
+	// Update slots state
+	next.slots = s.slots.push(blk.Number, slotsToAdd, t.maxBlocks, t.maxEntries)
+	t.state.Store(next)
+	if fetchErr != nil {
+		return fmt.Errorf("fail to fetch storage of block %v: %v", blk.Number, fetchErr.Error())
+	}
+	return nil
+}
+
+func (t *StorageTracker) CurrentWeight() uint {
+	return t.load().accessed.total
+}
+
+func (t *StorageTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	s := t.load()
+	if s.slots.len() == 0 {
+		return nil, fmt.Errorf("empty storage slots")
+	}
+	methodChooser, err := newWeightedChooser(t.methods)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := newBlockSelector(opts, accountTags)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Query, number)
+	e := newEncoder()
+	for i := uint(0); i < number; i++ {
+		entry := s.slots.random()
+		res[i] = Query{
+			Kind:     "storage",
+			Tracker:  "storage",
+			Contract: contractName(common.BytesToAddress(entry[:common.AddressLength])),
+		}
+		switch methodChooser.Pick().(string) {
+		case "storage_at":
+			res[i].Method = "eth_getStorageAt"
+			e.start(storageAtTpl, t.idGen.Next())
+		default:
+			res[i].Method = "eth_getProof"
+			e.start(proofTpl, t.idGen.Next())
+		}
+		e.hex(entry[:common.AddressLength])
+		e.hex(entry[common.AddressLength:])
+		selector.encode(e, s.blk, s.parentHash)
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
+	}
+	return res, nil
+}
+
+func (t *StorageTracker) Memory() uint64 {
+	return t.load().slots.bytes
+}
+
+func (t *StorageTracker) Status() string {
+	return fmt.Sprintf("%v", t.CurrentWeight())
+}
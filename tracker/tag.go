@@ -0,0 +1,124 @@
+package tracker
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	wr "github.com/mroth/weightedrand"
+)
+
+// BlockTags are the strategies of block parameters:
+// parent for the parent of the current block as a number,
+// latest, pending, safe and finalized for the block tags,
+// hash for the EIP-1898 block hash object of the parent,
+// recent for a random block up to the recent depth as a number,
+// archive for a historical block by the archive depth distribution.
+var BlockTags = []string{"parent", "latest", "pending", "safe", "finalized", "hash", "recent", "archive"}
+
+// ArchiveDepths are the depth distributions of archive blocks:
+// uniform over the archive range,
+// log for log-uniform back to genesis,
+// fixed for one of the archive offsets.
+var ArchiveDepths = []string{"uniform", "log", "fixed"}
+
+var (
+	// Default block parameters of calls, pinned to the parent
+	parentTags = map[string]uint{"parent": 1}
+	// Default block parameters of account queries, as sent by wallets
+	accountTags = map[string]uint{"parent": 1, "latest": 1, "pending": 1}
+)
+
+// GenerateOptions are the options of a query generation.
+type GenerateOptions struct {
+	// Shares of block parameter strategies, the default of each tracker
+	// if empty
+	BlockTags map[string]uint
+	// Maximum depth of the recent strategy
+	RecentDepth uint
+	// Depth distribution of the archive strategy, see ArchiveDepths
+	ArchiveDepth   string
+	ArchiveRange   uint
+	ArchiveOffsets []uint
+	// Whether token holders are sampled from the snapshot of the daemon
+	// instead of the live window, for trackers with a snapshot
+	Snapshot bool
+	// Percentage of eth_call queries carrying a state override, funding the
+	// sender of replayed transactions or patching ERC20 balances
+	OverrideShare uint
+}
+
+// blockSelector selects the block parameters of queries.
+type blockSelector struct {
+	chooser *wr.Chooser
+	opts    GenerateOptions
+}
+
+// newBlockSelector creates a block selector by the shares of the options,
+// or by the given default shares if not set.
+func newBlockSelector(opts GenerateOptions, defaults map[string]uint) (*blockSelector, error) {
+	shares := opts.BlockTags
+	if len(shares) == 0 {
+		shares = defaults
+	}
+	chooser, err := newWeightedChooser(shares)
+	if err != nil {
+		return nil, fmt.Errorf("fail to create block selector: %v", err.Error())
+	}
+	if opts.BlockTags["archive"] > 0 && opts.ArchiveDepth == "fixed" && len(opts.ArchiveOffsets) == 0 {
+		return nil, fmt.Errorf("fail to create block selector: empty archive offsets")
+	}
+	return &blockSelector{
+		chooser: chooser,
+		opts:    opts,
+	}, nil
+}
+
+// encode fills a hole of the encoder with a block parameter relative to the
+// given block and its parent hash. The parent number is used for the hash
+// strategy if the hash is unknown.
+func (s *blockSelector) encode(e *encoder, blk uint64, parentHash common.Hash) {
+	switch tag := s.chooser.Pick().(string); tag {
+	case "parent":
+		e.buf = append(e.buf, '"')
+		e.appendQuantity(blk - 1)
+		e.buf = append(e.buf, '"')
+	case "hash":
+		if parentHash == (common.Hash{}) {
+			e.buf = append(e.buf, '"')
+			e.appendQuantity(blk - 1)
+			e.buf = append(e.buf, '"')
+			break
+		}
+		e.buf = append(e.buf, `{"blockHash":"0x`...)
+		e.appendHex(parentHash[:])
+		e.buf = append(e.buf, `"}`...)
+	case "recent":
+		depth := uint64(1 + rand.Intn(int(maxUint(s.opts.RecentDepth, 1))))
+		e.buf = append(e.buf, '"')
+		e.appendQuantity(subFloor(blk, depth))
+		e.buf = append(e.buf, '"')
+	case "archive":
+		e.buf = append(e.buf, '"')
+		e.appendQuantity(subFloor(blk, s.archiveDepth(blk)))
+		e.buf = append(e.buf, '"')
+	default:
+		e.buf = append(e.buf, '"')
+		e.buf = append(e.buf, tag...)
+		e.buf = append(e.buf, '"')
+	}
+	e.next()
+}
+
+// archiveDepth gets a depth of archive blocks from the given block.
+func (s *blockSelector) archiveDepth(blk uint64) uint64 {
+	switch s.opts.ArchiveDepth {
+	case "log":
+		return uint64(math.Exp(rand.Float64() * math.Log(float64(blk))))
+	case "fixed":
+		return uint64(s.opts.ArchiveOffsets[rand.Intn(len(s.opts.ArchiveOffsets))])
+	default:
+		return uint64(1 + rand.Intn(int(maxUint(s.opts.ArchiveRange, 1))))
+	}
+}
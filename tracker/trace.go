@@ -0,0 +1,192 @@
+package tracker
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/wcgcyx/ethgen/idgen"
+)
+
+// TraceConfig is the configuration of generated tracing queries.
+type TraceConfig struct {
+	// Weights of methods:
+	// debug_tx for debug_traceTransaction,
+	// debug_call for debug_traceCall of a replayed transaction,
+	// debug_block for debug_traceBlockByNumber,
+	// trace_block for trace_block,
+	// trace_tx for trace_transaction,
+	// trace_replay for trace_replayTransaction.
+	Methods map[string]uint
+	// Weights of tracers:
+	// call for callTracer (trace for trace_replayTransaction),
+	// prestate for prestateTracer (stateDiff for trace_replayTransaction),
+	// struct for the struct logger (vmTrace for trace_replayTransaction).
+	Tracers map[string]uint
+	// Maximum logs of the struct logger, 0 for unlimited
+	StructLimit uint
+}
+
+var (
+	TraceMethods = []string{"debug_tx", "debug_call", "debug_block", "trace_block", "trace_tx", "trace_replay"}
+	TraceTracers = []string{"call", "prestate", "struct"}
+	// Templates of tracing methods
+	traceTxTpl      = compile(`{"jsonrpc":"2.0","id":$,"method":"debug_traceTransaction","params":["0x$",$]}`)
+	traceCallTpl    = compile(`{"jsonrpc":"2.0","id":$,"method":"debug_traceCall","params":[$,$,$]}`)
+	traceBlockTpl   = compile(`{"jsonrpc":"2.0","id":$,"method":"debug_traceBlockByNumber","params":["$",$]}`)
+	traceBlockPTpl  = compile(`{"jsonrpc":"2.0","id":$,"method":"trace_block","params":["$"]}`)
+	traceTxPTpl     = compile(`{"jsonrpc":"2.0","id":$,"method":"trace_transaction","params":["0x$"]}`)
+	traceReplayPTpl = compile(`{"jsonrpc":"2.0","id":$,"method":"trace_replayTransaction","params":["0x$",$]}`)
+	// Method names in categories by method and tracer
+	traceNames = make(map[string]map[string]string)
+)
+
+func init() {
+	for _, method := range []string{"debug_traceTransaction", "debug_traceCall", "debug_traceBlockByNumber", "trace_replayTransaction"} {
+		traceNames[method] = make(map[string]string)
+		for _, tracer := range TraceTracers {
+			traceNames[method][tracer] = method + ":" + tracer
+		}
+	}
+}
+
+// TraceTracker traces the transactions of a transaction tracker and the
+// blocks of a block tracker, sharing their windows.
+type TraceTracker struct {
+	// Id generator
+	idGen idgen.IdGenerator
+	// Transaction and block trackers
+	txTracker    *TransactionTracker
+	blockTracker *BlockTracker
+	// Configuration
+	cfg TraceConfig
+	// Config of the struct logger
+	structConfig string
+}
+
+func NewTraceTracker(idGen idgen.IdGenerator, txTracker *TransactionTracker, blockTracker *BlockTracker, cfg TraceConfig) *TraceTracker {
+	return &TraceTracker{
+		idGen:        idGen,
+		txTracker:    txTracker,
+		blockTracker: blockTracker,
+		cfg:          cfg,
+		structConfig: fmt.Sprintf(`{"disableStorage":true,"disableStack":false,"enableMemory":false,"enableReturnData":false,"limit":%d}`, cfg.StructLimit),
+	}
+}
+
+// ApplyBlock does nothing as blocks are applied to the transaction and
+// block trackers.
+func (t *TraceTracker) ApplyBlock(blk *Block) error {
+	return nil
+}
+
+func (t *TraceTracker) CurrentWeight() uint {
+	return t.txTracker.CurrentWeight()
+}
+
+func (t *TraceTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	transactions := t.txTracker.transactions()
+	if len(transactions) == 0 {
+		return nil, fmt.Errorf("empty transactions")
+	}
+	methodChooser, err := newWeightedChooser(t.cfg.Methods)
+	if err != nil {
+		return nil, err
+	}
+	tracerChooser, err := newWeightedChooser(t.cfg.Tracers)
+	if err != nil {
+		return nil, err
+	}
+	blockTags, err := newBlockSelector(opts, parentTags)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Query, number)
+	e := newEncoder()
+	for i := uint(0); i < number; i++ {
+		tx := transactions[rand.Intn(len(transactions))]
+		// Blocks are taken from the block window, or the block of the
+		// transaction if the window is empty.
+		blk := tx.number
+		if blocks := t.blockTracker.blocks(); len(blocks) > 0 {
+			blk = t.blockTracker.pick(blocks).number
+		}
+		tracer := tracerChooser.Pick().(string)
+		res[i] = Query{
+			Kind:     "trace",
+			Tracker:  "trace",
+			Contract: tx.contract,
+		}
+		switch methodChooser.Pick().(string) {
+		case "debug_tx":
+			res[i].Method = traceNames["debug_traceTransaction"][tracer]
+			e.start(traceTxTpl, t.idGen.Next())
+			e.hex(tx.hash[:])
+			e.str(t.tracerConfig(tracer))
+		case "debug_call":
+			res[i].Method = traceNames["debug_traceCall"][tracer]
+			e.start(traceCallTpl, t.idGen.Next())
+			e.str(tx.call)
+			blockTags.encode(e, tx.number, tx.parentHash)
+			e.str(t.tracerConfig(tracer))
+		case "debug_block":
+			res[i].Contract = ""
+			res[i].Method = traceNames["debug_traceBlockByNumber"][tracer]
+			e.start(traceBlockTpl, t.idGen.Next())
+			e.quantity(blk)
+			e.str(t.tracerConfig(tracer))
+		case "trace_block":
+			res[i].Contract = ""
+			res[i].Method = "trace_block"
+			e.start(traceBlockPTpl, t.idGen.Next())
+			e.quantity(blk)
+		case "trace_tx":
+			res[i].Method = "trace_transaction"
+			e.start(traceTxPTpl, t.idGen.Next())
+			e.hex(tx.hash[:])
+		default:
+			res[i].Method = traceNames["trace_replayTransaction"][tracer]
+			e.start(traceReplayPTpl, t.idGen.Next())
+			e.hex(tx.hash[:])
+			e.str(traceTypes(tracer))
+		}
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
+	}
+	return res, nil
+}
+
+// tracerConfig gets the debug_trace* config of a tracer.
+func (t *TraceTracker) tracerConfig(tracer string) string {
+	switch tracer {
+	case "call":
+		return `{"tracer":"callTracer"}`
+	case "prestate":
+		return `{"tracer":"prestateTracer"}`
+	default:
+		return t.structConfig
+	}
+}
+
+// traceTypes gets the trace_replayTransaction trace types of a tracer.
+func traceTypes(tracer string) string {
+	switch tracer {
+	case "call":
+		return `["trace"]`
+	case "prestate":
+		return `["stateDiff"]`
+	default:
+		return `["vmTrace"]`
+	}
+}
+
+// Memory is zero as the transactions and blocks are held by the transaction
+// and block trackers.
+func (t *TraceTracker) Memory() uint64 {
+	return 0
+}
+
+func (t *TraceTracker) Status() string {
+	return fmt.Sprintf("%v", t.txTracker.CurrentWeight())
+}
@@ -1,15 +1,46 @@
 package tracker
 
-import (
-	"github.com/ethereum/go-ethereum/core/types"
-)
-
 type Tracker interface {
-	ApplyBlock(blk *types.Block) error
+	// ApplyBlock applies a decoded block, shared by all trackers.
+	ApplyBlock(blk *Block) error
 
 	CurrentWeight() uint
 
-	GenerateQuery(number uint) ([]string, error)
+	// GenerateQuery generates the given number of queries, with the block
+	// parameters selected by the options.
+	GenerateQuery(number uint, opts GenerateOptions) ([]Query, error)
+
+	// Memory estimates the bytes held by the state of the tracker.
+	Memory() uint64
 
 	Status() string
 }
+
+// Query is a generated query tagged with where it originates from.
+type Query struct {
+	// Kind is the workload of the query, token or tx.
+	Kind string
+	// Tracker is the name of the tracker generating the query.
+	Tracker string
+	// Contract is the called contract, empty if none.
+	Contract string
+	// Method is the method selector of the call.
+	Method string
+	// Body is the json rpc request.
+	Body string
+}
+
+// Category gets the category of the query at the given level, which is one
+// of kind, tracker, contract or method.
+func (q Query) Category(level string) string {
+	switch level {
+	case "kind":
+		return q.Kind
+	case "tracker":
+		return q.Kind + "/" + q.Tracker
+	case "contract":
+		return q.Kind + "/" + q.Tracker + "/" + q.Contract
+	default:
+		return q.Kind + "/" + q.Tracker + "/" + q.Contract + "/" + q.Method
+	}
+}
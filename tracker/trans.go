@@ -2,101 +2,236 @@ package tracker
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"math/big"
 	"math/rand"
+	"strings"
+	"sync/atomic"
+	"unsafe"
 
-	"github.com/wcgcyx/ethgen/idgen"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/wcgcyx/ethgen/idgen"
 )
 
+var (
+	// TransactionMethods are the methods replaying transactions, eth_call,
+	// eth_estimateGas and eth_createAccessList.
+	TransactionMethods = []string{"call", "estimate", "access_list"}
+	// TransactionFields are the fields of replayed transactions that can be
+	// stripped, fees being gasPrice, maxFeePerGas and maxPriorityFeePerGas.
+	TransactionFields = []string{"value", "gas", "fees", "access_list"}
+)
+
+var (
+	// Templates of methods replaying transactions, by TransactionMethods,
+	// the call object and the block parameter being holes
+	replayTpls = []template{
+		compile(`{"jsonrpc":"2.0","id":$,"method":"eth_call","params":[$,$]}`),
+		compile(`{"jsonrpc":"2.0","id":$,"method":"eth_estimateGas","params":[$,$]}`),
+		compile(`{"jsonrpc":"2.0","id":$,"method":"eth_createAccessList","params":[$,$]}`),
+	}
+	// Template of eth_call with the state override funding the sender
+	replayOverrideTpl = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_call","params":[$,$,` + fundOverride() + `]}`)
+	replayMethods     = []string{"eth_call", "eth_estimateGas", "eth_createAccessList"}
+)
+
+// TransactionConfig is the configuration of replayed transactions.
+type TransactionConfig struct {
+	// Weights of methods replaying transactions
+	Methods map[string]uint
+	// Fields stripped from replayed transactions
+	Strip map[string]bool
+}
+
 type TransactionTracker struct {
 	// Id generator
 	idGen idgen.IdGenerator
-	// Signer
-	signer types.Signer
 	// Configuration
 	maxBlocks uint
+	cfg       TransactionConfig
+	// State, an immutable *transactionState swapped after every block
+	state atomic.Value
+}
+
+type transactionState struct {
 	// State of the tracker
-	weight   uint
-	accessed []uint
+	accessed window
 	// State of transactions
-	transactionsCount []uint
+	transactionsCount window
 	transactionsFlat  []wrappedTransaction
 }
 
 type wrappedTransaction struct {
 	transaction *types.Transaction
+	from        common.Address
+	hash        common.Hash
 	number      uint64
+	index       uint
+	parentHash  common.Hash
+	// Called contract, empty for contract creations
+	contract string
+	// Call object replaying the transaction, without the stripped fields
+	call string
+	// Names in categories of the replaying methods, by TransactionMethods,
+	// followed by eth_call with a state override
+	names [4]string
 }
 
-func NewTransactionTracker(idGen idgen.IdGenerator, maxBlocks uint) *TransactionTracker {
-	return &TransactionTracker{
-		idGen:             idGen,
-		signer:            types.NewLondonSigner(big.NewInt(1)),
-		maxBlocks:         maxBlocks,
-		weight:            0,
-		accessed:          make([]uint, maxBlocks),
-		transactionsCount: make([]uint, maxBlocks),
-		transactionsFlat:  make([]wrappedTransaction, 0),
+func NewTransactionTracker(idGen idgen.IdGenerator, maxBlocks uint, cfg TransactionConfig) *TransactionTracker {
+	t := &TransactionTracker{
+		idGen:     idGen,
+		maxBlocks: maxBlocks,
+		cfg:       cfg,
 	}
+	t.state.Store(&transactionState{})
+	return t
 }
 
-func (t *TransactionTracker) ApplyBlock(blk *types.Block) error {
+func (t *TransactionTracker) load() *transactionState {
+	return t.state.Load().(*transactionState)
+}
+
+// transactions gets the transactions of the current snapshot, oldest first.
+func (t *TransactionTracker) transactions() []wrappedTransaction {
+	return t.load().transactionsFlat
+}
+
+func (t *TransactionTracker) ApplyBlock(blk *Block) error {
 	accessed := uint(0)
 	transactionsToAdd := make([]wrappedTransaction, 0)
 	// Apply block
-	for i := 0; i < blk.Transactions().Len(); i++ {
-		tx := blk.Transactions()[i]
+	for _, tx := range blk.Txs {
 		accessed += 1
-		transactionsToAdd = append(transactionsToAdd, wrappedTransaction{
-			transaction: tx,
-			number:      blk.NumberU64(),
-		})
+		wrapped := wrappedTransaction{
+			transaction: tx.Transaction,
+			from:        tx.From,
+			hash:        tx.Transaction.Hash(),
+			number:      blk.Number,
+			index:       tx.Index,
+			parentHash:  blk.ParentHash,
+			contract:    tx.To,
+			call:        callObject(tx.Transaction, tx.From, t.cfg.Strip),
+		}
+		selector := tx.Selector
+		if tx.To == "" {
+			selector = "create"
+		}
+		for j, method := range replayMethods {
+			wrapped.names[j] = method + ":" + selector
+		}
+		wrapped.names[3] = wrapped.names[0] + ":override"
+		transactionsToAdd = append(transactionsToAdd, wrapped)
 	}
-	// Pop
-	pop1 := t.accessed[t.maxBlocks-1]
-	t.weight -= pop1
-	t.accessed = t.accessed[:t.maxBlocks-1]
-	// Push
-	t.weight += accessed
-	t.accessed = append([]uint{accessed}, t.accessed...)
-	// Pop
-	pop2 := t.transactionsCount[t.maxBlocks-1]
-	t.transactionsCount = t.transactionsCount[:t.maxBlocks-1]
-	t.transactionsFlat = t.transactionsFlat[:len(t.transactionsFlat)-int(pop2)]
-	// Push
-	t.transactionsCount = append([]uint{uint(len(transactionsToAdd))}, t.transactionsCount...)
-	t.transactionsFlat = append(transactionsToAdd, t.transactionsFlat...)
+	s := t.load()
+	next := &transactionState{}
+	next.accessed, _ = s.accessed.push(blk.Number, accessed, t.maxBlocks)
+	var pop uint
+	next.transactionsCount, pop = s.transactionsCount.push(blk.Number, uint(len(transactionsToAdd)), t.maxBlocks)
+	next.transactionsFlat = append(s.transactionsFlat[pop:], transactionsToAdd...)
+	t.state.Store(next)
 	return nil
 }
 
 func (t *TransactionTracker) CurrentWeight() uint {
-	return t.weight
+	return t.load().accessed.total
 }
 
-func (t *TransactionTracker) GenerateQuery(number uint) ([]string, error) {
-	if len(t.transactionsFlat) == 0 {
+func (t *TransactionTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	transactions := t.transactions()
+	if len(transactions) == 0 {
 		return nil, fmt.Errorf("empty transactions")
 	}
-	res := make([]string, number)
+	methodChooser, err := newWeightedChooser(t.cfg.Methods)
+	if err != nil {
+		return nil, err
+	}
+	blockTags, err := newBlockSelector(opts, parentTags)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Query, number)
+	e := newEncoder()
 	for i := uint(0); i < number; i++ {
-		index := rand.Intn(len(t.transactionsFlat))
-		tx := t.transactionsFlat[index]
-		id := t.idGen.Next()
-		fromAddr, err := t.signer.Sender(tx.transaction)
-		if err != nil {
-			return nil, err
+		tx := transactions[rand.Intn(len(transactions))]
+		var method int
+		switch methodChooser.Pick().(string) {
+		case "call":
+			method = 0
+		case "estimate":
+			method = 1
+		default:
+			method = 2
+		}
+		res[i] = Query{
+			Kind:     "tx",
+			Tracker:  "transaction",
+			Contract: tx.contract,
+			Method:   tx.names[method],
 		}
-		if tx.transaction.To() == nil {
-			res[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_call","params":[{"from":"%v","data":"0x%v"},"0x%x"]}`, id, fromAddr.String(), hex.EncodeToString(tx.transaction.Data()), tx.number-1)
+		if method == 0 && opts.override() {
+			res[i].Method = tx.names[3]
+			e.start(replayOverrideTpl, t.idGen.Next())
+			e.str(tx.call)
+			blockTags.encode(e, tx.number, tx.parentHash)
+			e.hex(tx.from[:])
 		} else {
-			res[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_call","params":[{"to":"%v","from":"%v","data":"0x%v"},"0x%x"]}`, id, tx.transaction.To().String(), fromAddr.String(), hex.EncodeToString(tx.transaction.Data()), tx.number-1)
+			e.start(replayTpls[method], t.idGen.Next())
+			e.str(tx.call)
+			blockTags.encode(e, tx.number, tx.parentHash)
 		}
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
 	}
 	return res, nil
 }
 
+func (t *TransactionTracker) Memory() uint64 {
+	transactions := t.transactions()
+	memory := uint64(cap(transactions)) * uint64(unsafe.Sizeof(wrappedTransaction{}))
+	for _, tx := range transactions {
+		memory += uint64(tx.transaction.Size()) + uint64(len(tx.contract)+len(tx.call))
+		for _, name := range tx.names {
+			memory += uint64(len(name))
+		}
+	}
+	return memory
+}
+
 func (t *TransactionTracker) Status() string {
-	return fmt.Sprintf("%v", t.weight)
+	return fmt.Sprintf("%v", t.CurrentWeight())
+}
+
+// callObject gets the call object replaying the transaction, without the
+// stripped fields.
+func callObject(tx *types.Transaction, from common.Address, strip map[string]bool) string {
+	fields := make([]string, 0)
+	if tx.To() != nil {
+		fields = append(fields, fmt.Sprintf(`"to":"%v"`, tx.To().String()))
+	}
+	fields = append(fields, fmt.Sprintf(`"from":"%v"`, from.String()))
+	if !strip["gas"] {
+		fields = append(fields, fmt.Sprintf(`"gas":"%v"`, hexutil.EncodeUint64(tx.Gas())))
+	}
+	if !strip["fees"] {
+		if tx.Type() == types.DynamicFeeTxType {
+			fields = append(fields, fmt.Sprintf(`"maxFeePerGas":"%v","maxPriorityFeePerGas":"%v"`, hexutil.EncodeBig(tx.GasFeeCap()), hexutil.EncodeBig(tx.GasTipCap())))
+		} else {
+			fields = append(fields, fmt.Sprintf(`"gasPrice":"%v"`, hexutil.EncodeBig(tx.GasPrice())))
+		}
+	}
+	if !strip["value"] && tx.Value().Sign() > 0 {
+		fields = append(fields, fmt.Sprintf(`"value":"%v"`, hexutil.EncodeBig(tx.Value())))
+	}
+	fields = append(fields, fmt.Sprintf(`"data":"0x%v"`, hex.EncodeToString(tx.Data())))
+	if !strip["access_list"] && len(tx.AccessList()) > 0 {
+		accessList, err := json.Marshal(tx.AccessList())
+		if err == nil {
+			fields = append(fields, fmt.Sprintf(`"accessList":%s`, accessList))
+		}
+	}
+	return "{" + strings.Join(fields, ",") + "}"
 }
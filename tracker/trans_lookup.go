@@ -0,0 +1,105 @@
+package tracker
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/wcgcyx/ethgen/idgen"
+)
+
+// TransactionLookupMethods are the lookup methods, eth_getTransactionByHash,
+// eth_getTransactionReceipt, eth_getBlockReceipts and
+// eth_getTransactionByBlockNumberAndIndex.
+var TransactionLookupMethods = []string{"tx", "receipt", "block_receipts", "tx_by_index"}
+
+var (
+	// Templates of lookup methods
+	txByHashTpl      = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getTransactionByHash","params":["0x$"]}`)
+	receiptTpl       = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getTransactionReceipt","params":["0x$"]}`)
+	blockReceiptsTpl = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getBlockReceipts","params":["$"]}`)
+	txByIndexTpl     = compile(`{"jsonrpc":"2.0","id":$,"method":"eth_getTransactionByBlockNumberAndIndex","params":["$","$"]}`)
+)
+
+// TransactionLookupTracker looks up the transactions of a transaction
+// tracker, sharing its window.
+type TransactionLookupTracker struct {
+	// Id generator
+	idGen idgen.IdGenerator
+	// Transaction tracker
+	txTracker *TransactionTracker
+	// Configuration
+	methods map[string]uint
+}
+
+func NewTransactionLookupTracker(idGen idgen.IdGenerator, txTracker *TransactionTracker, methods map[string]uint) *TransactionLookupTracker {
+	return &TransactionLookupTracker{
+		idGen:     idGen,
+		txTracker: txTracker,
+		methods:   methods,
+	}
+}
+
+// ApplyBlock does nothing as blocks are applied to the transaction tracker.
+func (t *TransactionLookupTracker) ApplyBlock(blk *Block) error {
+	return nil
+}
+
+func (t *TransactionLookupTracker) CurrentWeight() uint {
+	return t.txTracker.CurrentWeight()
+}
+
+func (t *TransactionLookupTracker) GenerateQuery(number uint, opts GenerateOptions) ([]Query, error) {
+	transactions := t.txTracker.transactions()
+	if len(transactions) == 0 {
+		return nil, fmt.Errorf("empty transactions")
+	}
+	methodChooser, err := newWeightedChooser(t.methods)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Query, number)
+	e := newEncoder()
+	for i := uint(0); i < number; i++ {
+		tx := transactions[rand.Intn(len(transactions))]
+		res[i] = Query{
+			Kind:     "lookup",
+			Tracker:  "transaction_lookup",
+			Contract: tx.contract,
+		}
+		switch methodChooser.Pick().(string) {
+		case "tx":
+			res[i].Method = "eth_getTransactionByHash"
+			e.start(txByHashTpl, t.idGen.Next())
+			e.hex(tx.hash[:])
+		case "receipt":
+			res[i].Method = "eth_getTransactionReceipt"
+			e.start(receiptTpl, t.idGen.Next())
+			e.hex(tx.hash[:])
+		case "block_receipts":
+			res[i].Contract = ""
+			res[i].Method = "eth_getBlockReceipts"
+			e.start(blockReceiptsTpl, t.idGen.Next())
+			e.quantity(tx.number)
+		default:
+			res[i].Contract = ""
+			res[i].Method = "eth_getTransactionByBlockNumberAndIndex"
+			e.start(txByIndexTpl, t.idGen.Next())
+			e.quantity(tx.number)
+			e.quantity(uint64(tx.index))
+		}
+		e.finish()
+	}
+	for i, body := range e.bodies() {
+		res[i].Body = body
+	}
+	return res, nil
+}
+
+// Memory is zero as the transactions are held by the transaction tracker.
+func (t *TransactionLookupTracker) Memory() uint64 {
+	return 0
+}
+
+func (t *TransactionLookupTracker) Status() string {
+	return fmt.Sprintf("%v", t.txTracker.CurrentWeight())
+}
@@ -0,0 +1,136 @@
+package tracker
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// window is an immutable sliding window of per-block counts, oldest first.
+//
+// Tracker states are published as immutable snapshots after every block.
+// Their lists are ordered oldest first, so a new block is appended at the
+// end and the oldest block is resliced off the front. The backing arrays are
+// shared with previous snapshots, which never read beyond their own length.
+//
+// Blocks are kept by number and empty blocks are not kept, so a tracker
+// only needs to see the blocks with entries and the blocks at which those
+// leave the window.
+type window struct {
+	numbers []uint64
+	counts  []uint
+	total   uint
+}
+
+// push gets the window with the count of a new block, and the count of the
+// blocks popped as they left the window.
+func (w window) push(number uint64, count uint, maxBlocks uint) (window, uint) {
+	popped := uint(0)
+	numbers, counts := w.numbers, w.counts
+	for len(numbers) > 0 && numbers[0]+uint64(maxBlocks) <= number {
+		popped += counts[0]
+		numbers, counts = numbers[1:], counts[1:]
+	}
+	if count > 0 {
+		numbers, counts = append(numbers, number), append(counts, count)
+	}
+	return window{
+		numbers: numbers,
+		counts:  counts,
+		total:   w.total - popped + count,
+	}, popped
+}
+
+// sampledWindow is a window of a list capped by sampling. Every block keeps
+// a uniform reservoir of its entries, at most a budget, and picks are
+// weighted by the true count of the block, so the sample stays
+// representative of the window while the oldest block is still evicted
+// first.
+type sampledWindow struct {
+	// Number of every block, empty blocks not kept
+	numbers []uint64
+	// Cumulative true and kept counts up to the end of every block since the
+	// first block ever pushed, led by the counts before the oldest block
+	ends     []uint64
+	keptEnds []uint64
+}
+
+// push gets the window with the true and kept counts of a new block, and the
+// kept count of the blocks popped as they left the window.
+func (w sampledWindow) push(number uint64, count uint, kept uint, maxBlocks uint) (sampledWindow, uint) {
+	numbers, ends, keptEnds := w.numbers, w.ends, w.keptEnds
+	if len(ends) == 0 {
+		ends, keptEnds = []uint64{0}, []uint64{0}
+	}
+	expired := 0
+	for expired < len(numbers) && numbers[expired]+uint64(maxBlocks) <= number {
+		expired++
+	}
+	popped := uint(keptEnds[expired] - keptEnds[0])
+	numbers, ends, keptEnds = numbers[expired:], ends[expired:], keptEnds[expired:]
+	if count > 0 {
+		last := len(ends) - 1
+		numbers = append(numbers, number)
+		ends = append(ends, ends[last]+uint64(count))
+		keptEnds = append(keptEnds, keptEnds[last]+uint64(kept))
+	}
+	return sampledWindow{
+		numbers:  numbers,
+		ends:     ends,
+		keptEnds: keptEnds,
+	}, popped
+}
+
+// pick gets the position of a random entry in the kept list, weighted by the
+// true count of its block. The list must not be empty.
+func (w sampledWindow) pick() int {
+	last := len(w.ends) - 1
+	total := w.ends[last] - w.ends[0]
+	kept := w.keptEnds[last] - w.keptEnds[0]
+	if kept == total {
+		// Nothing sampled
+		return rand.Intn(int(kept))
+	}
+	target := w.ends[0] + uint64(rand.Int63n(int64(total)))
+	i := sort.Search(last, func(i int) bool {
+		return w.ends[i+1] > target
+	})
+	start := w.keptEnds[i] - w.keptEnds[0]
+	return int(start) + rand.Intn(int(w.keptEnds[i+1]-w.keptEnds[i]))
+}
+
+// memory estimates the bytes held by the window.
+func (w sampledWindow) memory() uint64 {
+	return uint64(8 * (cap(w.numbers) + cap(w.ends) + cap(w.keptEnds)))
+}
+
+// budget gets the entries kept per block under a cap of the window, zero
+// for no cap. Rounded down so a full window stays within the cap, a cap
+// below the window keeps one entry per block.
+func budget(maxEntries uint, maxBlocks uint) uint {
+	if maxEntries == 0 {
+		return 0
+	}
+	if maxEntries < maxBlocks {
+		return 1
+	}
+	return maxEntries / maxBlocks
+}
+
+// reservoir samples k of n positions uniformly, in order, or gets nil if
+// every position is kept.
+func reservoir(n uint, k uint) []int {
+	if k == 0 || n <= k {
+		return nil
+	}
+	res := make([]int, k)
+	for i := range res {
+		res[i] = i
+	}
+	for i := int(k); i < int(n); i++ {
+		if j := rand.Intn(i + 1); j < int(k) {
+			res[j] = i
+		}
+	}
+	sort.Ints(res)
+	return res
+}